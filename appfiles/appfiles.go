@@ -0,0 +1,208 @@
+// Package appfiles decides which files of an app directory are packaged,
+// following the same rules git uses for a push to Heroku.
+package appfiles
+
+import (
+	"fmt"
+	"os"
+	"path"
+	"path/filepath"
+	"regexp"
+	"strings"
+
+	"github.com/heroku/tatara/util"
+)
+
+// excludes are tatara's own build outputs
+var excludes = []*regexp.Regexp{
+	regexp.MustCompile(`^.+\.slug$`),
+	regexp.MustCompile(`^.+\.slug\.json$`),
+	regexp.MustCompile(`^\..+\.cache$`),
+	regexp.MustCompile(`^.+\.slug\.tmp$`),
+	regexp.MustCompile(`(^|/)\.slug-tar-[^/]*$`),
+	regexp.MustCompile(`^tatara\.lock$`),
+}
+
+type Options struct {
+	// TrackedOnly packages only the files tracked by git
+	TrackedOnly bool
+}
+
+// Filter applies .slugignore, every .gitignore in the app directory and its
+// parents up to the git work tree, .git/info/exclude and core.excludesFile
+type Filter struct {
+	root       string
+	prefix     string
+	excludes   []patternList
+	gitignores map[string]patternList
+	slugignore patternList
+	tracked    map[string]bool
+}
+
+func NewFilter(appDir string, options Options) (*Filter, error) {
+	absAppDir, err := filepath.Abs(appDir)
+	if err != nil {
+		return nil, err
+	}
+	if resolved, err := filepath.EvalSymlinks(absAppDir); err == nil {
+		absAppDir = resolved
+	}
+
+	f := &Filter{
+		root:       absAppDir,
+		gitignores: map[string]patternList{},
+	}
+	f.slugignore, err = readPatterns(filepath.Join(absAppDir, ".slugignore"), "")
+	if err != nil {
+		return nil, err
+	}
+
+	if root, err := util.GitTopLevel(absAppDir); err == nil {
+		if prefix, err := filepath.Rel(root, absAppDir); err == nil && !strings.HasPrefix(prefix, "..") {
+			f.root = root
+			if prefix != "." {
+				f.prefix = filepath.ToSlash(prefix)
+			}
+		}
+		if excludesFile := util.GitExcludesFile(absAppDir); excludesFile != "" {
+			list, err := readPatterns(excludesFile, "")
+			if err != nil {
+				return nil, err
+			}
+			f.excludes = append(f.excludes, list)
+		}
+		if gitDir, err := util.GitDir(absAppDir); err == nil {
+			list, err := readPatterns(filepath.Join(gitDir, "info", "exclude"), "")
+			if err != nil {
+				return nil, err
+			}
+			f.excludes = append(f.excludes, list)
+		}
+	}
+
+	if options.TrackedOnly {
+		files, err := util.GitTrackedFiles(absAppDir)
+		if err != nil {
+			return nil, fmt.Errorf("packaging only tracked files requires %s to be in a git repository", appDir)
+		}
+		f.tracked = map[string]bool{}
+		for _, file := range files {
+			for ; file != "." && !f.tracked[file]; file = path.Dir(file) {
+				f.tracked[file] = true
+			}
+		}
+	}
+	return f, nil
+}
+
+// Ignored reports whether a path relative to the app directory, with slash
+// separators, is left out of the app
+func (f *Filter) Ignored(relPath string, isDir bool) (bool, error) {
+	if isDir && path.Base(relPath) == ".git" {
+		return true, nil
+	}
+	if !isDir {
+		for _, exclude := range excludes {
+			if exclude.MatchString(relPath) {
+				return true, nil
+			}
+		}
+	}
+	if matched, ignored := f.slugignore.match(relPath, isDir); matched && ignored {
+		return true, nil
+	}
+
+	// tracked files are packaged even if they match a .gitignore
+	if f.tracked != nil {
+		return !f.tracked[relPath], nil
+	}
+
+	fullPath := relPath
+	if f.prefix != "" {
+		fullPath = f.prefix + "/" + relPath
+	}
+	ignored := false
+	for _, list := range f.excludes {
+		if matched, listIgnored := list.match(fullPath, isDir); matched {
+			ignored = listIgnored
+		}
+	}
+	// deeper .gitignore files take precedence
+	dirs := strings.Split(fullPath, "/")
+	for i := range dirs {
+		list, err := f.gitignore(strings.Join(dirs[:i], "/"))
+		if err != nil {
+			return false, err
+		}
+		if matched, listIgnored := list.match(fullPath, isDir); matched {
+			ignored = listIgnored
+		}
+	}
+	return ignored, nil
+}
+
+func (f *Filter) gitignore(dir string) (patternList, error) {
+	if list, ok := f.gitignores[dir]; ok {
+		return list, nil
+	}
+	list, err := readPatterns(filepath.Join(f.root, filepath.FromSlash(dir), ".gitignore"), dir)
+	if err != nil {
+		return list, err
+	}
+	f.gitignores[dir] = list
+	return list, nil
+}
+
+// WalkFunc is called with the path and the slash separated path relative to
+// the app directory of every file and directory that is packaged
+type WalkFunc func(path, relPath string, info os.FileInfo) error
+
+// Walk walks the app directory, skipping ignored files and directories
+func Walk(appDir string, options Options, fn WalkFunc) error {
+	filter, err := NewFilter(appDir, options)
+	if err != nil {
+		return err
+	}
+	return filepath.Walk(appDir, func(file string, info os.FileInfo, err error) error {
+		if err != nil {
+			return err
+		}
+		relPath, err := filepath.Rel(appDir, file)
+		if err != nil || relPath == "." {
+			return err
+		}
+		relPath = filepath.ToSlash(relPath)
+
+		ignored, err := filter.Ignored(relPath, info.IsDir())
+		if err != nil {
+			return err
+		}
+		if ignored {
+			if info.IsDir() {
+				return filepath.SkipDir
+			}
+			return nil
+		}
+		return fn(file, relPath, info)
+	})
+}
+
+// Special reports whether a file is a socket, device or named pipe, which
+// can't be packaged
+func Special(info os.FileInfo) bool {
+	return info.Mode()&(os.ModeSocket|os.ModeDevice|os.ModeCharDevice|os.ModeNamedPipe) != 0
+}
+
+// Describe names the kind of a special file
+func Describe(info os.FileInfo) string {
+	mode := info.Mode()
+	switch {
+	case mode&os.ModeSocket != 0:
+		return "socket"
+	case mode&os.ModeNamedPipe != 0:
+		return "named pipe"
+	case mode&os.ModeDevice != 0:
+		return "device"
+	}
+	return "special file"
+}
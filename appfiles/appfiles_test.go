@@ -0,0 +1,125 @@
+package appfiles
+
+import (
+	"io/ioutil"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func writeFiles(t *testing.T, dir string, files map[string]string) {
+	for name, contents := range files {
+		path := filepath.Join(dir, filepath.FromSlash(name))
+		assert.Nil(t, os.MkdirAll(filepath.Dir(path), 0755))
+		assert.Nil(t, ioutil.WriteFile(path, []byte(contents), 0644))
+	}
+}
+
+func listFiles(t *testing.T, dir string, options Options) []string {
+	files := []string{}
+	err := Walk(dir, options, func(path, relPath string, info os.FileInfo) error {
+		if !info.IsDir() {
+			files = append(files, relPath)
+		}
+		return nil
+	})
+	assert.Nil(t, err)
+	return files
+}
+
+func TestWalkNestedIgnores(t *testing.T) {
+	dir, err := ioutil.TempDir("", "app")
+	assert.Nil(t, err)
+	defer os.RemoveAll(dir)
+
+	writeFiles(t, dir, map[string]string{
+		".gitignore":          "*.log\n/tmp/\nbuild/\n",
+		".slugignore":         "docs\n",
+		"app.rb":              "",
+		"debug.log":           "",
+		"tmp/cache":           "",
+		"lib/tmp/keep":        "",
+		"lib/.gitignore":      "!important.log\n*.bak\n",
+		"lib/important.log":   "",
+		"lib/other.log":       "",
+		"lib/file.bak":        "",
+		"lib/nested/file.bak": "",
+		"assets/build/app.js": "",
+		"assets/**/x":         "",
+		"docs/README":         "",
+		"myapp.slug":          "",
+		"myapp.slug.json":     "",
+		"myapp.slug.tmp":      "",
+		".slug-tar-123":       "",
+		"tatara.lock":         "",
+		".myapp.cache":        "",
+	})
+
+	assert.Equal(t, []string{
+		".gitignore",
+		".slugignore",
+		"app.rb",
+		"assets/**/x",
+		"lib/.gitignore",
+		"lib/important.log",
+		"lib/tmp/keep",
+	}, listFiles(t, dir, Options{}))
+}
+
+func TestWalkGitExcludesAndTrackedOnly(t *testing.T) {
+	dir, err := ioutil.TempDir("", "app")
+	assert.Nil(t, err)
+	defer os.RemoveAll(dir)
+
+	git := func(args ...string) {
+		cmd := exec.Command("git", args...)
+		cmd.Dir = dir
+		out, err := cmd.CombinedOutput()
+		assert.Nil(t, err, string(out))
+	}
+	git("init", "--quiet")
+	writeFiles(t, dir, map[string]string{
+		".git/info/exclude": "secrets.env\n",
+		".gitignore":        "vendor/\n",
+		"app.rb":            "",
+		"secrets.env":       "",
+		"vendor/lib.rb":     "",
+		"untracked.rb":      "",
+	})
+	git("add", ".gitignore", "app.rb")
+	git("add", "--force", "vendor/lib.rb")
+
+	assert.Equal(t, []string{".gitignore", "app.rb", "untracked.rb"}, listFiles(t, dir, Options{}))
+	assert.Equal(t, []string{".gitignore", "app.rb", "vendor/lib.rb"}, listFiles(t, dir, Options{TrackedOnly: true}))
+}
+
+func TestParsePattern(t *testing.T) {
+	for _, test := range []struct {
+		pattern string
+		path    string
+		isDir   bool
+		matches bool
+	}{
+		{"*.log", "a/b/debug.log", false, true},
+		{"/debug.log", "a/debug.log", false, false},
+		{"doc/*.txt", "doc/notes.txt", false, true},
+		{"doc/*.txt", "doc/server/arch.txt", false, false},
+		{"**/foo", "a/b/foo", false, true},
+		{"abc/**", "abc/x/y", false, true},
+		{"a/**/b", "a/b", false, true},
+		{"a/**/b", "a/x/y/b", false, true},
+		{"build/", "build", false, false},
+		{"build/", "build", true, true},
+		{"file[0-9].txt", "file1.txt", false, true},
+		{"file[!0-9].txt", "file1.txt", false, false},
+		{`\#notcomment`, "#notcomment", false, true},
+	} {
+		p, ok := parsePattern(test.pattern)
+		assert.True(t, ok, test.pattern)
+		matched, _ := patternList{patterns: []pattern{p}}.match(test.path, test.isDir)
+		assert.Equal(t, test.matches, matched, "%s against %s", test.pattern, test.path)
+	}
+}
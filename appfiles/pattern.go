@@ -0,0 +1,142 @@
+package appfiles
+
+import (
+	"bufio"
+	"os"
+	"regexp"
+	"strings"
+)
+
+// pattern is a single line of a .gitignore file
+type pattern struct {
+	regexp  *regexp.Regexp
+	negate  bool
+	dirOnly bool
+}
+
+// patternList is the patterns from one file, which apply to paths under dir
+type patternList struct {
+	dir      string
+	patterns []pattern
+}
+
+// readPatterns reads a gitignore file, returning no patterns if it doesn't
+// exist
+func readPatterns(path, dir string) (patternList, error) {
+	list := patternList{dir: dir}
+	file, err := os.Open(path)
+	if os.IsNotExist(err) {
+		return list, nil
+	} else if err != nil {
+		return list, err
+	}
+	defer file.Close()
+
+	scanner := bufio.NewScanner(file)
+	for scanner.Scan() {
+		if p, ok := parsePattern(scanner.Text()); ok {
+			list.patterns = append(list.patterns, p)
+		}
+	}
+	return list, scanner.Err()
+}
+
+func parsePattern(line string) (pattern, bool) {
+	line = strings.TrimSuffix(line, "\r")
+	// trailing spaces are ignored unless escaped
+	for strings.HasSuffix(line, " ") && !strings.HasSuffix(line, `\ `) {
+		line = line[:len(line)-1]
+	}
+	if line == "" || strings.HasPrefix(line, "#") {
+		return pattern{}, false
+	}
+
+	var p pattern
+	if strings.HasPrefix(line, "!") {
+		p.negate = true
+		line = line[1:]
+	}
+	if strings.HasSuffix(line, "/") {
+		p.dirOnly = true
+		line = strings.TrimRight(line, "/")
+	}
+	if line == "" {
+		return pattern{}, false
+	}
+
+	// patterns with a slash are relative to the directory of the file,
+	// others match a name at any depth
+	anchored := strings.Contains(line, "/")
+	line = strings.TrimPrefix(line, "/")
+
+	expr := globToRegexp(line)
+	if !anchored {
+		expr = "(.*/)?" + expr
+	}
+	re, err := regexp.Compile("^" + expr + "$")
+	if err != nil {
+		return pattern{}, false
+	}
+	p.regexp = re
+	return p, true
+}
+
+// globToRegexp converts gitignore glob syntax, including ** for any number
+// of directories, to a regular expression
+func globToRegexp(glob string) string {
+	var expr strings.Builder
+	for i := 0; i < len(glob); i++ {
+		c := glob[i]
+		switch {
+		case strings.HasPrefix(glob[i:], "**/") && (i == 0 || glob[i-1] == '/'):
+			expr.WriteString("(.*/)?")
+			i += 2
+		case strings.HasPrefix(glob[i:], "**") && i+2 == len(glob) && (i == 0 || glob[i-1] == '/'):
+			expr.WriteString(".*")
+			i++
+		case c == '*':
+			expr.WriteString("[^/]*")
+		case c == '?':
+			expr.WriteString("[^/]")
+		case c == '[':
+			end := strings.IndexByte(glob[i+1:], ']')
+			if end < 0 {
+				expr.WriteString(`\[`)
+				continue
+			}
+			class := glob[i+1 : i+1+end]
+			if strings.HasPrefix(class, "!") {
+				class = "^" + class[1:]
+			}
+			expr.WriteString("[" + strings.Replace(class, `\`, `\\`, -1) + "]")
+			i += end + 1
+		case c == '\\' && i+1 < len(glob):
+			i++
+			expr.WriteString(regexp.QuoteMeta(string(glob[i])))
+		default:
+			expr.WriteString(regexp.QuoteMeta(string(c)))
+		}
+	}
+	return expr.String()
+}
+
+// match reports whether the list has an opinion on a path, relative to the
+// root that list.dir is relative to, and whether that opinion is to ignore
+// it. The last matching pattern wins.
+func (l patternList) match(path string, isDir bool) (matched, ignored bool) {
+	if l.dir != "" {
+		if !strings.HasPrefix(path, l.dir+"/") {
+			return false, false
+		}
+		path = path[len(l.dir)+1:]
+	}
+	for _, p := range l.patterns {
+		if p.dirOnly && !isDir {
+			continue
+		}
+		if p.regexp.MatchString(path) {
+			matched, ignored = true, !p.negate
+		}
+	}
+	return matched, ignored
+}
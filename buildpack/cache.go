@@ -0,0 +1,173 @@
+package buildpack
+
+import (
+	"crypto/sha256"
+	"encoding/json"
+	"fmt"
+	"io"
+	"io/ioutil"
+	"net/http"
+	"os"
+	"path"
+	"path/filepath"
+	"strings"
+	"sync"
+)
+
+// Cache stores downloaded buildpack archives by the sha256 of their contents,
+// with an index from each buildpack URL to its sha256
+type Cache struct {
+	Dir string
+	// Offline makes Fetch fail instead of downloading uncached buildpacks
+	Offline bool
+	// Update makes Fetch download buildpacks again even if they are cached
+	Update bool
+
+	lock sync.Mutex
+}
+
+// DefaultCacheDir is $TATARA_BUILDPACK_CACHE, or ~/.tatara/buildpacks
+func DefaultCacheDir() string {
+	if dir := os.Getenv("TATARA_BUILDPACK_CACHE"); dir != "" {
+		return dir
+	}
+	home := os.Getenv("HOME")
+	if home == "" {
+		home = os.Getenv("USERPROFILE")
+	}
+	if home == "" {
+		return filepath.Join(os.TempDir(), "tatara-buildpacks")
+	}
+	return filepath.Join(home, ".tatara", "buildpacks")
+}
+
+// Fetch returns the path and sha256 of the cached archive for a buildpack
+// URL, downloading it first if it isn't cached
+func (c *Cache) Fetch(url string) (string, string, error) {
+	c.lock.Lock()
+	defer c.lock.Unlock()
+
+	index, err := c.readIndex()
+	if err != nil {
+		return "", "", err
+	}
+
+	if sha, ok := index[url]; ok && !c.Update {
+		blobPath := c.blobPath(url, sha)
+		if c.verify(blobPath, sha) {
+			return blobPath, sha, nil
+		}
+	}
+
+	if c.Offline {
+		return "", "", fmt.Errorf("buildpack %s is not cached, build once without --offline to download it", url)
+	}
+
+	sha, err := c.download(url)
+	if err != nil {
+		return "", "", err
+	}
+	index[url] = sha
+	if err := c.writeIndex(index); err != nil {
+		return "", "", err
+	}
+	return c.blobPath(url, sha), sha, nil
+}
+
+// Lookup returns the sha256 a buildpack URL is cached under, if it is cached
+func (c *Cache) Lookup(url string) (string, bool) {
+	c.lock.Lock()
+	defer c.lock.Unlock()
+
+	index, err := c.readIndex()
+	if err != nil {
+		return "", false
+	}
+	sha, ok := index[url]
+	return sha, ok
+}
+
+func (c *Cache) download(url string) (string, error) {
+	if err := os.MkdirAll(filepath.Join(c.Dir, "blobs"), 0755); err != nil {
+		return "", err
+	}
+
+	res, err := http.Get(url)
+	if err != nil {
+		return "", fmt.Errorf("could not download buildpack %s: %s", url, err)
+	}
+	defer res.Body.Close()
+	if res.StatusCode != http.StatusOK {
+		return "", fmt.Errorf("could not download buildpack %s: %s", url, res.Status)
+	}
+
+	tmpFile, err := ioutil.TempFile(c.Dir, "download-")
+	if err != nil {
+		return "", err
+	}
+	defer os.Remove(tmpFile.Name())
+
+	hasher := sha256.New()
+	_, err = io.Copy(io.MultiWriter(tmpFile, hasher), res.Body)
+	tmpFile.Close()
+	if err != nil {
+		return "", fmt.Errorf("could not download buildpack %s: %s", url, err)
+	}
+
+	sha := fmt.Sprintf("%x", hasher.Sum(nil))
+	return sha, os.Rename(tmpFile.Name(), c.blobPath(url, sha))
+}
+
+func (c *Cache) verify(blobPath, sha string) bool {
+	file, err := os.Open(blobPath)
+	if err != nil {
+		return false
+	}
+	defer file.Close()
+
+	hasher := sha256.New()
+	if _, err := io.Copy(hasher, file); err != nil {
+		return false
+	}
+	return fmt.Sprintf("%x", hasher.Sum(nil)) == sha
+}
+
+// blobPath keeps the archive extension of the URL so that Zip can tell
+// .zip archives from .tgz archives
+func (c *Cache) blobPath(url, sha string) string {
+	ext := ".tgz"
+	if base := path.Base(url); strings.HasSuffix(base, ".zip") {
+		ext = ".zip"
+	}
+	return filepath.Join(c.Dir, "blobs", sha+ext)
+}
+
+func (c *Cache) indexPath() string {
+	return filepath.Join(c.Dir, "index.json")
+}
+
+func (c *Cache) readIndex() (map[string]string, error) {
+	index := map[string]string{}
+	indexBytes, err := ioutil.ReadFile(c.indexPath())
+	if os.IsNotExist(err) {
+		return index, nil
+	} else if err != nil {
+		return nil, err
+	}
+	if err := json.Unmarshal(indexBytes, &index); err != nil {
+		return nil, fmt.Errorf("invalid buildpack cache index %s: %s", c.indexPath(), err)
+	}
+	return index, nil
+}
+
+func (c *Cache) writeIndex(index map[string]string) error {
+	indexBytes, err := json.MarshalIndent(index, "", "  ")
+	if err != nil {
+		return err
+	}
+	tmpPath := c.indexPath() + ".tmp"
+	if err := ioutil.WriteFile(tmpPath, indexBytes, 0644); err != nil {
+		return err
+	}
+	return os.Rename(tmpPath, c.indexPath())
+}
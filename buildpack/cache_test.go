@@ -0,0 +1,51 @@
+package buildpack
+
+import (
+	"io/ioutil"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestCacheFetchesOnce(t *testing.T) {
+	requests := 0
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		requests++
+		w.Write([]byte("buildpack"))
+	}))
+	defer server.Close()
+
+	dir, err := ioutil.TempDir("", "cache")
+	assert.Nil(t, err)
+	defer os.RemoveAll(dir)
+
+	cache := &Cache{Dir: dir}
+	path, sha, err := cache.Fetch(server.URL + "/ruby.tgz")
+	assert.Nil(t, err)
+	assert.Equal(t, "d7e91d8b2fe4e850416f69aa49d8550fcb01bf48cf7e8ac4a5900cfc871f9e3c", sha)
+	assert.Equal(t, filepath.Join(dir, "blobs", sha+".tgz"), path)
+
+	contents, err := ioutil.ReadFile(path)
+	assert.Nil(t, err)
+	assert.Equal(t, "buildpack", string(contents))
+
+	offline := &Cache{Dir: dir, Offline: true}
+	_, cachedSha, err := offline.Fetch(server.URL + "/ruby.tgz")
+	assert.Nil(t, err)
+	assert.Equal(t, sha, cachedSha)
+	assert.Equal(t, 1, requests)
+}
+
+func TestCacheOfflineMiss(t *testing.T) {
+	dir, err := ioutil.TempDir("", "cache")
+	assert.Nil(t, err)
+	defer os.RemoveAll(dir)
+
+	cache := &Cache{Dir: dir, Offline: true}
+	_, _, err = cache.Fetch("https://example.com/ruby.tgz")
+	assert.EqualError(t, err, "buildpack https://example.com/ruby.tgz is not cached, build once without --offline to download it")
+}
@@ -0,0 +1,140 @@
+package buildpack
+
+import (
+	"crypto/sha256"
+	"fmt"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"strings"
+)
+
+// ParseGitURL splits a git buildpack URL like
+// https://github.com/heroku/heroku-buildpack-ruby.git#v200 into its
+// repository and ref. Repositories are recognized by a git scheme, a .git
+// suffix, or a #ref on any URL or local directory that isn't an archive.
+// Local directories have to be given as paths, like LocalPath.
+func ParseGitURL(buildpack string) (string, string, bool) {
+	repo, ref := buildpack, ""
+	if i := strings.LastIndex(buildpack, "#"); i >= 0 {
+		repo, ref = buildpack[:i], buildpack[i+1:]
+	}
+
+	for _, prefix := range []string{"git://", "ssh://", "git+ssh://", "git@"} {
+		if strings.HasPrefix(repo, prefix) {
+			return repo, ref, true
+		}
+	}
+	if strings.HasSuffix(strings.TrimSuffix(repo, "/"), ".git") {
+		return repo, ref, true
+	}
+	if ref == "" {
+		return "", "", false
+	}
+	for _, ext := range []string{".tgz", ".tar.gz", ".zip"} {
+		if strings.HasSuffix(repo, ext) {
+			return "", "", false
+		}
+	}
+	if strings.Contains(repo, "://") {
+		return repo, ref, true
+	}
+	if path, ok := LocalPath(repo); ok {
+		if info, err := os.Stat(path); err == nil && info.IsDir() {
+			return repo, ref, true
+		}
+	}
+	return "", "", false
+}
+
+// FetchGit returns a checkout of a git buildpack at the given ref, or at the
+// default branch if the ref is empty, along with the commit it resolved to.
+// Checkouts are kept in the cache and fetched again unless offline.
+func (c *Cache) FetchGit(repo, ref string) (string, string, error) {
+	return c.fetchGit(repo, ref, "")
+}
+
+// FetchGitCommit returns a checkout of a git buildpack at a commit, like one
+// recorded in a lockfile. The repository is only fetched again if the commit
+// isn't in the cache.
+func (c *Cache) FetchGitCommit(repo, commit string) (string, error) {
+	dir, _, err := c.fetchGit(repo, "", commit)
+	return dir, err
+}
+
+func (c *Cache) fetchGit(repo, ref, commit string) (string, string, error) {
+	c.lock.Lock()
+	defer c.lock.Unlock()
+
+	checkoutDir := filepath.Join(c.Dir, "git", fmt.Sprintf("%x", sha256.Sum256([]byte(repo))))
+	if _, err := os.Stat(checkoutDir); os.IsNotExist(err) {
+		if c.Offline {
+			return "", "", fmt.Errorf("buildpack %s is not cached, build once without --offline to download it", repo)
+		}
+		if err := os.MkdirAll(filepath.Dir(checkoutDir), 0755); err != nil {
+			return "", "", err
+		}
+		if _, err := git("", "clone", "--quiet", "--no-checkout", repo, checkoutDir); err != nil {
+			os.RemoveAll(checkoutDir)
+			return "", "", err
+		}
+	} else if err != nil {
+		return "", "", err
+	} else if !c.Offline && (commit == "" || !hasGitCommit(checkoutDir, commit)) {
+		if _, err := git(checkoutDir, "fetch", "--quiet", "--tags", "--force", "origin"); err != nil {
+			return "", "", err
+		}
+	}
+
+	if commit != "" {
+		if !hasGitCommit(checkoutDir, commit) {
+			return "", "", fmt.Errorf("could not find commit %s in buildpack %s", commit, repo)
+		}
+	} else {
+		var err error
+		commit, err = resolveGitRef(checkoutDir, ref)
+		if err != nil {
+			return "", "", fmt.Errorf("could not find ref %s in buildpack %s", ref, repo)
+		}
+	}
+	if _, err := git(checkoutDir, "checkout", "--quiet", "--force", commit); err != nil {
+		return "", "", err
+	}
+	if _, err := git(checkoutDir, "clean", "--quiet", "-ffdx"); err != nil {
+		return "", "", err
+	}
+	return checkoutDir, commit, nil
+}
+
+func hasGitCommit(dir, commit string) bool {
+	_, err := git(dir, "rev-parse", "--verify", "--quiet", commit+"^{commit}")
+	return err == nil
+}
+
+// resolveGitRef prefers remote branches over local ones, so that branch refs
+// follow the fetched repository
+func resolveGitRef(dir, ref string) (string, error) {
+	candidates := []string{"origin/HEAD"}
+	if ref != "" {
+		candidates = []string{"origin/" + ref, ref}
+	}
+	var err error
+	for _, candidate := range candidates {
+		var commit string
+		commit, err = git(dir, "rev-parse", "--verify", "--quiet", candidate+"^{commit}")
+		if err == nil {
+			return commit, nil
+		}
+	}
+	return "", err
+}
+
+func git(dir string, args ...string) (string, error) {
+	cmd := exec.Command("git", args...)
+	cmd.Dir = dir
+	out, err := cmd.CombinedOutput()
+	if err != nil {
+		return "", fmt.Errorf("git %s failed: %s", args[0], strings.TrimSpace(string(out)))
+	}
+	return strings.TrimSpace(string(out)), nil
+}
@@ -0,0 +1,98 @@
+package buildpack
+
+import (
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestParseGitURL(t *testing.T) {
+	repo, ref, ok := ParseGitURL("https://github.com/heroku/heroku-buildpack-ruby.git#v200")
+	assert.True(t, ok)
+	assert.Equal(t, "https://github.com/heroku/heroku-buildpack-ruby.git", repo)
+	assert.Equal(t, "v200", ref)
+
+	repo, ref, ok = ParseGitURL("https://github.com/heroku/heroku-buildpack-ruby#main")
+	assert.True(t, ok)
+	assert.Equal(t, "https://github.com/heroku/heroku-buildpack-ruby", repo)
+	assert.Equal(t, "main", ref)
+
+	repo, ref, ok = ParseGitURL("git@github.com:heroku/heroku-buildpack-ruby")
+	assert.True(t, ok)
+	assert.Equal(t, "git@github.com:heroku/heroku-buildpack-ruby", repo)
+	assert.Equal(t, "", ref)
+
+	_, _, ok = ParseGitURL("https://example.com/ruby.tgz")
+	assert.False(t, ok)
+	_, _, ok = ParseGitURL("https://example.com/ruby.tgz#v1")
+	assert.False(t, ok)
+	_, _, ok = ParseGitURL("./missing#v1")
+	assert.False(t, ok)
+
+	repo, ref, ok = ParseGitURL(".#v1")
+	assert.True(t, ok)
+	assert.Equal(t, ".", repo)
+	assert.Equal(t, "v1", ref)
+}
+
+func TestCacheFetchGit(t *testing.T) {
+	repoDir, err := ioutil.TempDir("", "repo")
+	assert.Nil(t, err)
+	defer os.RemoveAll(repoDir)
+
+	commit := func(contents string) {
+		assert.Nil(t, ioutil.WriteFile(filepath.Join(repoDir, "VERSION"), []byte(contents), 0644))
+		_, err := git(repoDir, "add", "VERSION")
+		assert.Nil(t, err)
+		_, err = git(repoDir, "-c", "user.name=test", "-c", "user.email=test@example.com", "commit", "--quiet", "-m", contents)
+		assert.Nil(t, err)
+	}
+	_, err = git(repoDir, "init", "--quiet")
+	assert.Nil(t, err)
+	commit("v1")
+	_, err = git(repoDir, "tag", "v1")
+	assert.Nil(t, err)
+	commit("v2")
+
+	cacheDir, err := ioutil.TempDir("", "cache")
+	assert.Nil(t, err)
+	defer os.RemoveAll(cacheDir)
+
+	cache := &Cache{Dir: cacheDir}
+	dir, v1Commit, err := cache.FetchGit(repoDir, "v1")
+	assert.Nil(t, err)
+	contents, err := ioutil.ReadFile(filepath.Join(dir, "VERSION"))
+	assert.Nil(t, err)
+	assert.Equal(t, "v1", string(contents))
+
+	dir, headCommit, err := cache.FetchGit(repoDir, "")
+	assert.Nil(t, err)
+	assert.NotEqual(t, v1Commit, headCommit)
+	contents, err = ioutil.ReadFile(filepath.Join(dir, "VERSION"))
+	assert.Nil(t, err)
+	assert.Equal(t, "v2", string(contents))
+
+	_, _, err = cache.FetchGit(repoDir, "v3")
+	assert.EqualError(t, err, "could not find ref v3 in buildpack "+repoDir)
+
+	offline := &Cache{Dir: cacheDir, Offline: true}
+	_, cachedCommit, err := offline.FetchGit(repoDir, "v1")
+	assert.Nil(t, err)
+	assert.Equal(t, v1Commit, cachedCommit)
+
+	// a locked commit is checked out even though the branch moved on
+	dir, err = cache.FetchGitCommit(repoDir, v1Commit)
+	assert.Nil(t, err)
+	contents, err = ioutil.ReadFile(filepath.Join(dir, "VERSION"))
+	assert.Nil(t, err)
+	assert.Equal(t, "v1", string(contents))
+
+	_, err = offline.FetchGitCommit(repoDir, headCommit)
+	assert.Nil(t, err)
+
+	_, err = cache.FetchGitCommit(repoDir, "0123456789abcdef0123456789abcdef01234567")
+	assert.EqualError(t, err, "could not find commit 0123456789abcdef0123456789abcdef01234567 in buildpack "+repoDir)
+}
@@ -0,0 +1,200 @@
+package buildpack
+
+import (
+	"archive/tar"
+	"archive/zip"
+	"bytes"
+	"compress/gzip"
+	"crypto/md5"
+	"fmt"
+	"io"
+	"io/ioutil"
+	"net/url"
+	"os"
+	"path/filepath"
+	"strings"
+)
+
+// Key returns the name a packaged buildpack is stored under in the staging
+// container, which is how the stager matches it to its buildpack URL
+func Key(buildpackURL string) string {
+	return fmt.Sprintf("%x", md5.Sum([]byte(buildpackURL)))
+}
+
+// LocalPath returns the path of a buildpack given as a file:// URL, an
+// absolute path or a path starting with ./ or ../. Other names are never
+// local, even if they exist in the working directory, so that heroku/ruby
+// always refers to the registry.
+func LocalPath(buildpack string) (string, bool) {
+	if strings.HasPrefix(buildpack, "file://") {
+		u, err := url.Parse(buildpack)
+		if err != nil {
+			return "", false
+		}
+		return filepath.FromSlash(u.Path), true
+	}
+	if filepath.IsAbs(buildpack) {
+		return buildpack, true
+	}
+	path := filepath.ToSlash(buildpack)
+	if path == "." || path == ".." || strings.HasPrefix(path, "./") || strings.HasPrefix(path, "../") {
+		return buildpack, true
+	}
+	return "", false
+}
+
+// FileURL returns the file:// URL of a local buildpack
+func FileURL(path string) (string, error) {
+	absPath, err := filepath.Abs(path)
+	if err != nil {
+		return "", err
+	}
+	return (&url.URL{Scheme: "file", Path: filepath.ToSlash(absPath)}).String(), nil
+}
+
+// Zip packages a local buildpack directory, .tgz or .zip archive as a zip
+// archive
+func Zip(path string) (io.ReadCloser, int64, error) {
+	info, err := os.Stat(path)
+	if err != nil {
+		return nil, 0, err
+	}
+
+	buf := &bytes.Buffer{}
+	switch {
+	case info.IsDir():
+		err = zipDir(buf, path)
+	case strings.HasSuffix(path, ".zip"):
+		var data []byte
+		data, err = ioutil.ReadFile(path)
+		buf = bytes.NewBuffer(data)
+	case strings.HasSuffix(path, ".tgz"), strings.HasSuffix(path, ".tar.gz"):
+		err = zipTgz(buf, path)
+	default:
+		err = fmt.Errorf("buildpack %s must be a directory, .tgz or .zip file", path)
+	}
+	if err != nil {
+		return nil, 0, err
+	}
+	return ioutil.NopCloser(buf), int64(buf.Len()), nil
+}
+
+func zipDir(w io.Writer, dir string) error {
+	zipWriter := zip.NewWriter(w)
+	err := filepath.Walk(dir, func(path string, info os.FileInfo, err error) error {
+		if err != nil {
+			return err
+		}
+		relPath, err := filepath.Rel(dir, path)
+		if err != nil || relPath == "." {
+			return err
+		}
+		if info.IsDir() && info.Name() == ".git" {
+			return filepath.SkipDir
+		}
+
+		header, err := zip.FileInfoHeader(info)
+		if err != nil {
+			return err
+		}
+		header.Name = filepath.ToSlash(relPath)
+		header.Method = zip.Deflate
+
+		switch {
+		case info.IsDir():
+			header.Name += "/"
+			_, err = zipWriter.CreateHeader(header)
+			return err
+		case info.Mode()&os.ModeSymlink != 0:
+			target, err := os.Readlink(path)
+			if err != nil {
+				return err
+			}
+			entry, err := zipWriter.CreateHeader(header)
+			if err != nil {
+				return err
+			}
+			_, err = entry.Write([]byte(target))
+			return err
+		case info.Mode().IsRegular():
+			entry, err := zipWriter.CreateHeader(header)
+			if err != nil {
+				return err
+			}
+			file, err := os.Open(path)
+			if err != nil {
+				return err
+			}
+			defer file.Close()
+			_, err = io.Copy(entry, file)
+			return err
+		}
+		return nil
+	})
+	if err != nil {
+		return err
+	}
+	return zipWriter.Close()
+}
+
+func zipTgz(w io.Writer, path string) error {
+	file, err := os.Open(path)
+	if err != nil {
+		return err
+	}
+	defer file.Close()
+
+	gzipReader, err := gzip.NewReader(file)
+	if err != nil {
+		return err
+	}
+	defer gzipReader.Close()
+
+	tarReader := tar.NewReader(gzipReader)
+	zipWriter := zip.NewWriter(w)
+	for {
+		header, err := tarReader.Next()
+		if err == io.EOF {
+			break
+		} else if err != nil {
+			return err
+		}
+
+		name := strings.TrimPrefix(filepath.ToSlash(filepath.Clean(header.Name)), "./")
+		if name == "." || name == "" {
+			continue
+		}
+
+		zipHeader, err := zip.FileInfoHeader(header.FileInfo())
+		if err != nil {
+			return err
+		}
+		zipHeader.Name = name
+		zipHeader.Method = zip.Deflate
+
+		switch header.Typeflag {
+		case tar.TypeDir:
+			zipHeader.Name += "/"
+			if _, err := zipWriter.CreateHeader(zipHeader); err != nil {
+				return err
+			}
+		case tar.TypeSymlink:
+			entry, err := zipWriter.CreateHeader(zipHeader)
+			if err != nil {
+				return err
+			}
+			if _, err := entry.Write([]byte(header.Linkname)); err != nil {
+				return err
+			}
+		case tar.TypeReg, tar.TypeRegA:
+			entry, err := zipWriter.CreateHeader(zipHeader)
+			if err != nil {
+				return err
+			}
+			if _, err := io.Copy(entry, tarReader); err != nil {
+				return err
+			}
+		}
+	}
+	return zipWriter.Close()
+}
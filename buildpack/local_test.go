@@ -0,0 +1,107 @@
+package buildpack
+
+import (
+	"archive/tar"
+	"archive/zip"
+	"bytes"
+	"compress/gzip"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestLocalPath(t *testing.T) {
+	path, ok := LocalPath("file:///tmp/my-buildpack")
+	assert.True(t, ok)
+	assert.Equal(t, filepath.FromSlash("/tmp/my-buildpack"), path)
+
+	path, ok = LocalPath("./my-buildpack")
+	assert.True(t, ok)
+	assert.Equal(t, "./my-buildpack", path)
+
+	_, ok = LocalPath("https://example.com/buildpack.tgz")
+	assert.False(t, ok)
+
+	path, ok = LocalPath("../my-buildpack")
+	assert.True(t, ok)
+	assert.Equal(t, "../my-buildpack", path)
+
+	_, ok = LocalPath("heroku/ruby")
+	assert.False(t, ok)
+
+	_, ok = LocalPath(".buildpacks")
+	assert.False(t, ok)
+}
+
+func TestLocalPathIgnoresWorkingDir(t *testing.T) {
+	dir, err := ioutil.TempDir("", "buildpacks")
+	assert.Nil(t, err)
+	defer os.RemoveAll(dir)
+	wd, err := os.Getwd()
+	assert.Nil(t, err)
+	defer os.Chdir(wd)
+	assert.Nil(t, os.Chdir(dir))
+
+	assert.Nil(t, os.MkdirAll(filepath.Join("heroku", "ruby"), 0755))
+	assert.Nil(t, os.Mkdir("ruby", 0755))
+
+	_, ok := LocalPath("heroku/ruby")
+	assert.False(t, ok)
+	_, ok = LocalPath("ruby")
+	assert.False(t, ok)
+	_, _, ok = ParseGitURL("ruby#v1")
+	assert.False(t, ok)
+}
+
+func TestZipDir(t *testing.T) {
+	dir, err := ioutil.TempDir("", "buildpack")
+	assert.Nil(t, err)
+	defer os.RemoveAll(dir)
+
+	assert.Nil(t, os.Mkdir(filepath.Join(dir, "bin"), 0755))
+	assert.Nil(t, ioutil.WriteFile(filepath.Join(dir, "bin", "compile"), []byte("#!/bin/sh\n"), 0755))
+
+	files := zipEntries(t, dir)
+	assert.Equal(t, os.FileMode(0755), files["bin/compile"].Mode().Perm())
+	assert.Contains(t, files, "bin/")
+}
+
+func TestZipTgz(t *testing.T) {
+	dir, err := ioutil.TempDir("", "buildpack")
+	assert.Nil(t, err)
+	defer os.RemoveAll(dir)
+
+	buf := &bytes.Buffer{}
+	gzipWriter := gzip.NewWriter(buf)
+	tarWriter := tar.NewWriter(gzipWriter)
+	tarWriter.WriteHeader(&tar.Header{Name: "./bin/", Typeflag: tar.TypeDir, Mode: 0755})
+	tarWriter.WriteHeader(&tar.Header{Name: "./bin/detect", Typeflag: tar.TypeReg, Mode: 0755, Size: 10})
+	tarWriter.Write([]byte("#!/bin/sh\n"))
+	tarWriter.Close()
+	gzipWriter.Close()
+
+	tgzPath := filepath.Join(dir, "buildpack.tgz")
+	assert.Nil(t, ioutil.WriteFile(tgzPath, buf.Bytes(), 0644))
+
+	files := zipEntries(t, tgzPath)
+	assert.Equal(t, os.FileMode(0755), files["bin/detect"].Mode().Perm())
+}
+
+func zipEntries(t *testing.T, path string) map[string]*zip.File {
+	zipFile, size, err := Zip(path)
+	assert.Nil(t, err)
+	data, err := ioutil.ReadAll(zipFile)
+	assert.Nil(t, err)
+	assert.Equal(t, int64(len(data)), size)
+
+	reader, err := zip.NewReader(bytes.NewReader(data), size)
+	assert.Nil(t, err)
+	files := map[string]*zip.File{}
+	for _, f := range reader.File {
+		files[f.Name] = f
+	}
+	return files
+}
@@ -0,0 +1,66 @@
+package buildpack
+
+import (
+	"fmt"
+	"sort"
+)
+
+// LockedBuildpack is the exact archive or git commit a buildpack URL
+// resolved to
+type LockedBuildpack struct {
+	URL    string `json:"url"`
+	SHA256 string `json:"sha256,omitempty"`
+	Commit string `json:"commit,omitempty"`
+}
+
+// Lockfile records the checksum of every remote buildpack an app was built
+// with, so that later builds fail instead of silently using a different
+// archive
+type Lockfile struct {
+	Buildpacks []LockedBuildpack `json:"buildpacks"`
+}
+
+// Sort orders the buildpacks by URL, so that the lockfile is stable
+func (l *Lockfile) Sort() {
+	sort.Slice(l.Buildpacks, func(i, j int) bool {
+		return l.Buildpacks[i].URL < l.Buildpacks[j].URL
+	})
+}
+
+// Lock records what a buildpack URL resolved to
+func (l *Lockfile) Lock(buildpack LockedBuildpack) {
+	for i, locked := range l.Buildpacks {
+		if locked.URL == buildpack.URL {
+			l.Buildpacks[i] = buildpack
+			return
+		}
+	}
+	l.Buildpacks = append(l.Buildpacks, buildpack)
+}
+
+// Commit returns the commit a git buildpack URL is locked to, if any
+func (l *Lockfile) Commit(url string) string {
+	for _, locked := range l.Buildpacks {
+		if locked.URL == url {
+			return locked.Commit
+		}
+	}
+	return ""
+}
+
+// Verify checks that a buildpack resolved to its locked checksum or commit,
+// if the buildpack URL is locked
+func (l *Lockfile) Verify(buildpack LockedBuildpack) error {
+	for _, locked := range l.Buildpacks {
+		if locked.URL != buildpack.URL {
+			continue
+		}
+		if locked.SHA256 != buildpack.SHA256 {
+			return fmt.Errorf("buildpack %s has checksum %s but the lockfile expects %s, run `tatara lock --update` to update it", buildpack.URL, buildpack.SHA256, locked.SHA256)
+		}
+		if locked.Commit != buildpack.Commit {
+			return fmt.Errorf("buildpack %s is at commit %s but the lockfile expects %s, run `tatara lock --update` to update it", buildpack.URL, buildpack.Commit, locked.Commit)
+		}
+	}
+	return nil
+}
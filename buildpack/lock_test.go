@@ -0,0 +1,32 @@
+package buildpack
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestLockfile(t *testing.T) {
+	lock := &Lockfile{}
+	lock.Lock(LockedBuildpack{URL: "https://example.com/ruby.tgz", SHA256: "abc"})
+	lock.Lock(LockedBuildpack{URL: "https://example.com/node.tgz", SHA256: "def"})
+	lock.Lock(LockedBuildpack{URL: "https://example.com/go.git#v1", Commit: "0123"})
+	lock.Sort()
+
+	assert.Equal(t, []LockedBuildpack{
+		{URL: "https://example.com/go.git#v1", Commit: "0123"},
+		{URL: "https://example.com/node.tgz", SHA256: "def"},
+		{URL: "https://example.com/ruby.tgz", SHA256: "abc"},
+	}, lock.Buildpacks)
+
+	assert.Nil(t, lock.Verify(LockedBuildpack{URL: "https://example.com/ruby.tgz", SHA256: "abc"}))
+	assert.Nil(t, lock.Verify(LockedBuildpack{URL: "https://example.com/php.tgz", SHA256: "123"}))
+	assert.EqualError(t, lock.Verify(LockedBuildpack{URL: "https://example.com/ruby.tgz", SHA256: "xyz"}),
+		"buildpack https://example.com/ruby.tgz has checksum xyz but the lockfile expects abc, run `tatara lock --update` to update it")
+	assert.EqualError(t, lock.Verify(LockedBuildpack{URL: "https://example.com/go.git#v1", Commit: "4567"}),
+		"buildpack https://example.com/go.git#v1 is at commit 4567 but the lockfile expects 0123, run `tatara lock --update` to update it")
+
+	assert.Equal(t, "0123", lock.Commit("https://example.com/go.git#v1"))
+	assert.Equal(t, "", lock.Commit("https://example.com/ruby.tgz"))
+	assert.Equal(t, "", lock.Commit("https://example.com/go.git#v2"))
+}
@@ -0,0 +1,65 @@
+package buildpack
+
+import (
+	"fmt"
+	"os"
+	"regexp"
+	"strings"
+)
+
+// DefaultRegistryURL is the buildpack registry used when none is configured
+const DefaultRegistryURL = "https://buildpack-registry.s3.amazonaws.com"
+
+var (
+	registryName    = regexp.MustCompile(`^[A-Za-z0-9][A-Za-z0-9_-]*(/[A-Za-z0-9][A-Za-z0-9_-]*)?$`)
+	registryVersion = regexp.MustCompile(`^[A-Za-z0-9][A-Za-z0-9._-]*$`)
+)
+
+// RegistryURL returns the buildpack registry to use, preferring the given
+// flag value, then $TATARA_BUILDPACK_REGISTRY, then the heroku.yml value
+func RegistryURL(flagURL, configURL string) string {
+	for _, url := range []string{flagURL, os.Getenv("TATARA_BUILDPACK_REGISTRY"), configURL} {
+		if url != "" {
+			return strings.TrimSuffix(url, "/")
+		}
+	}
+	return DefaultRegistryURL
+}
+
+// RegistryArchiveURL returns the archive URL of a registry buildpack given as
+// [namespace/]name[@version]. Versioned buildpacks are stored under
+// buildpacks/<namespace>/<name>/<version>.tgz, and the latest version under
+// buildpacks/<namespace>/<name>.tgz.
+func RegistryArchiveURL(registry, ref string) (string, error) {
+	name, version := ref, ""
+	if i := strings.LastIndex(ref, "@"); i >= 0 {
+		name, version = ref[:i], ref[i+1:]
+		if !registryVersion.MatchString(version) {
+			return "", fmt.Errorf("invalid version in buildpack %s", ref)
+		}
+	}
+	if !registryName.MatchString(name) {
+		return "", fmt.Errorf("invalid buildpack %s, expected a URL, a local path or a registry name like heroku/ruby@v200", ref)
+	}
+
+	path := name
+	if version != "" {
+		path += "/" + version
+	}
+	return fmt.Sprintf("%s/buildpacks/%s.tgz", strings.TrimSuffix(registry, "/"), path), nil
+}
+
+// Resolve returns the URL of a buildpack given as a URL, a git URL, a local
+// path or a registry name. Local paths are returned unchanged.
+func Resolve(registry, ref string) (string, error) {
+	if _, _, ok := ParseGitURL(ref); ok {
+		return ref, nil
+	}
+	if strings.Contains(ref, "://") {
+		return ref, nil
+	}
+	if _, ok := LocalPath(ref); ok {
+		return ref, nil
+	}
+	return RegistryArchiveURL(registry, ref)
+}
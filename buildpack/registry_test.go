@@ -0,0 +1,40 @@
+package buildpack
+
+import (
+	"os"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestRegistryArchiveURL(t *testing.T) {
+	url, err := RegistryArchiveURL(DefaultRegistryURL, "heroku/ruby@v215")
+	assert.Nil(t, err)
+	assert.Equal(t, "https://buildpack-registry.s3.amazonaws.com/buildpacks/heroku/ruby/v215.tgz", url)
+
+	url, err = RegistryArchiveURL("https://registry.example.com/", "heroku/ruby")
+	assert.Nil(t, err)
+	assert.Equal(t, "https://registry.example.com/buildpacks/heroku/ruby.tgz", url)
+
+	url, err = RegistryArchiveURL(DefaultRegistryURL, "ruby")
+	assert.Nil(t, err)
+	assert.Equal(t, "https://buildpack-registry.s3.amazonaws.com/buildpacks/ruby.tgz", url)
+
+	_, err = RegistryArchiveURL(DefaultRegistryURL, "heroku/ruby@")
+	assert.EqualError(t, err, "invalid version in buildpack heroku/ruby@")
+
+	_, err = RegistryArchiveURL(DefaultRegistryURL, "heroku/ruby/extra")
+	assert.NotNil(t, err)
+}
+
+func TestRegistryURL(t *testing.T) {
+	os.Setenv("TATARA_BUILDPACK_REGISTRY", "https://env.example.com")
+	defer os.Unsetenv("TATARA_BUILDPACK_REGISTRY")
+
+	assert.Equal(t, "https://flag.example.com", RegistryURL("https://flag.example.com/", "https://config.example.com"))
+	assert.Equal(t, "https://env.example.com", RegistryURL("", "https://config.example.com"))
+
+	os.Unsetenv("TATARA_BUILDPACK_REGISTRY")
+	assert.Equal(t, "https://config.example.com", RegistryURL("", "https://config.example.com"))
+	assert.Equal(t, DefaultRegistryURL, RegistryURL("", ""))
+}
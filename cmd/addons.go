@@ -0,0 +1,196 @@
+package main
+
+import (
+	"context"
+	"fmt"
+	"regexp"
+	"strconv"
+	"time"
+
+	"github.com/docker/docker/api/types"
+	"github.com/docker/docker/api/types/container"
+	"github.com/docker/docker/api/types/mount"
+	"github.com/docker/docker/api/types/network"
+	dockerClient "github.com/docker/docker/client"
+	"github.com/docker/go-connections/nat"
+	"github.com/heroku/tatara/heroku"
+)
+
+const addonHealthTimeout = 60 * time.Second
+
+// addonEnvironment holds the containers that emulate an app's add-ons and the
+// network they share with the app.
+type addonEnvironment struct {
+	client       *dockerClient.Client
+	appName      string
+	networkID    string
+	containerIDs []string
+
+	// NetContainerID is the container whose network the app should join.
+	// It publishes the app's ports, since the app can't publish its own.
+	NetContainerID string
+	// ConfigVars holds the URL config var of every add-on
+	ConfigVars map[string]string
+}
+
+// startAddons starts a container for every add-on on a new network, along
+// with a container on the same network for the app to share. The ports map
+// holds the host port to publish for each container port.
+func startAddons(appName, runImage string, addons []heroku.Addon, hostIP string, ports map[int]int) (*addonEnvironment, error) {
+	client, err := dockerClient.NewEnvClient()
+	if err != nil {
+		return nil, err
+	}
+
+	ctx := context.Background()
+	networkName := fmt.Sprintf("tatara-%s-%d", appName, time.Now().Unix())
+	net, err := client.NetworkCreate(ctx, networkName, types.NetworkCreate{
+		Labels: tataraLabels(appName),
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	env := &addonEnvironment{
+		client:     client,
+		appName:    appName,
+		networkID:  net.ID,
+		ConfigVars: map[string]string{},
+	}
+
+	for _, addon := range addons {
+		service, err := addon.LocalService()
+		if err != nil {
+			env.Close()
+			return nil, err
+		}
+
+		var serviceEnv []string
+		for name, value := range service.Env {
+			serviceEnv = append(serviceEnv, fmt.Sprintf("%s=%s", name, value))
+		}
+
+		// the data is kept in a volume per app, so that the release phase
+		// and later runs use the same database
+		hostConfig := &container.HostConfig{}
+		if service.DataDir != "" {
+			hostConfig.Mounts = []mount.Mount{{
+				Type:          mount.TypeVolume,
+				Source:        addonVolume(appName, addon),
+				Target:        service.DataDir,
+				VolumeOptions: &mount.VolumeOptions{Labels: tataraLabels(appName)},
+			}}
+		}
+
+		id, err := env.start(&container.Config{
+			Image: service.Image,
+			Env:   serviceEnv,
+			Healthcheck: &container.HealthConfig{
+				Test:     service.HealthCheck,
+				Interval: time.Second,
+				Retries:  int(addonHealthTimeout / time.Second),
+			},
+		}, hostConfig, networkName, addon.Hostname())
+		if err != nil {
+			env.Close()
+			return nil, err
+		}
+
+		if err := env.waitUntilHealthy(id, addon.Plan); err != nil {
+			env.Close()
+			return nil, err
+		}
+		env.ConfigVars[service.ConfigVar] = service.URL
+	}
+
+	exposedPorts := nat.PortSet{}
+	portBindings := nat.PortMap{}
+	for port, hostPort := range ports {
+		containerPort := nat.Port(fmt.Sprintf("%d/tcp", port))
+		exposedPorts[containerPort] = struct{}{}
+		portBindings[containerPort] = []nat.PortBinding{{HostIP: hostIP, HostPort: strconv.Itoa(hostPort)}}
+	}
+
+	env.NetContainerID, err = env.start(&container.Config{
+		Image:        runImage,
+		Cmd:          []string{"sleep", "infinity"},
+		ExposedPorts: exposedPorts,
+	}, &container.HostConfig{
+		PortBindings: portBindings,
+	}, networkName, appName)
+	if err != nil {
+		env.Close()
+		return nil, err
+	}
+
+	return env, nil
+}
+
+var volumeNameUnsafe = regexp.MustCompile(`[^a-zA-Z0-9_.-]`)
+
+// addonVolume names the volume that keeps the data of an app's add-on
+func addonVolume(appName string, addon heroku.Addon) string {
+	return fmt.Sprintf("tatara-%s-%s", volumeNameUnsafe.ReplaceAllString(appName, "-"), addon.Hostname())
+}
+
+// appAddons returns the add-ons in heroku.yml, or in app.json if heroku.yml
+// has none
+func appAddons(herokuConfig heroku.Config, appJSON heroku.AppJSON) []heroku.Addon {
+	if len(herokuConfig.Setup.Addons) > 0 {
+		return herokuConfig.Setup.Addons
+	}
+	return appJSON.Addons
+}
+
+func (a *addonEnvironment) start(config *container.Config, hostConfig *container.HostConfig, networkName, alias string) (string, error) {
+	ctx := context.Background()
+	config.Labels = tataraLabels(a.appName)
+	created, err := a.client.ContainerCreate(ctx, config, hostConfig, &network.NetworkingConfig{
+		EndpointsConfig: map[string]*network.EndpointSettings{
+			networkName: {Aliases: []string{alias}},
+		},
+	}, "")
+	if err != nil {
+		return "", err
+	}
+	a.containerIDs = append(a.containerIDs, created.ID)
+
+	return created.ID, a.client.ContainerStart(ctx, created.ID, types.ContainerStartOptions{})
+}
+
+func (a *addonEnvironment) waitUntilHealthy(id, plan string) error {
+	timeout := time.After(addonHealthTimeout)
+	for {
+		info, err := a.client.ContainerInspect(context.Background(), id)
+		if err != nil {
+			return err
+		}
+		if !info.State.Running {
+			return fmt.Errorf("add-on %s exited before becoming available", plan)
+		}
+		if info.State.Health == nil || info.State.Health.Status == "healthy" {
+			return nil
+		}
+
+		select {
+		case <-timeout:
+			return fmt.Errorf("add-on %s did not become available within %s", plan, addonHealthTimeout)
+		case <-time.After(time.Second):
+		}
+	}
+}
+
+// Close removes the add-on containers and their network. The volumes with
+// the add-on data are kept.
+func (a *addonEnvironment) Close() {
+	ctx := context.Background()
+	for _, id := range a.containerIDs {
+		err := a.client.ContainerRemove(ctx, id, types.ContainerRemoveOptions{Force: true, RemoveVolumes: true})
+		if err != nil {
+			fmt.Printf("Couldn't remove add-on container: %s\n", err.Error())
+		}
+	}
+	if err := a.client.NetworkRemove(ctx, a.networkID); err != nil {
+		fmt.Printf("Couldn't remove add-on network: %s\n", err.Error())
+	}
+}
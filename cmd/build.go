@@ -4,14 +4,15 @@ import (
 	"archive/tar"
 	"bytes"
 	"context"
+	"crypto/sha256"
 	"errors"
 	"fmt"
 	"io"
 	"io/ioutil"
 	"os"
 	"path/filepath"
-	"regexp"
 	"strings"
+	"time"
 
 	"github.com/buildpack/forge"
 	"github.com/buildpack/forge/engine"
@@ -20,22 +21,19 @@ import (
 	dockerClient "github.com/docker/docker/client"
 	"github.com/docker/docker/pkg/jsonmessage"
 	"github.com/fatih/color"
+	"github.com/heroku/tatara/appfiles"
+	"github.com/heroku/tatara/buildpack"
 	"github.com/heroku/tatara/cli"
 	"github.com/heroku/tatara/fs"
 	"github.com/heroku/tatara/heroku"
 	"github.com/heroku/tatara/ui"
 	"github.com/heroku/tatara/util"
-	ignore "github.com/sabhiram/go-gitignore"
 )
 
 const (
 	HerokuStack = "heroku-16"
 )
 
-func BuildStack(stack string) string {
-	return fmt.Sprintf("packs/%s:build", stack)
-}
-
 var cmdBuild = cli.Command{
 	Name: "build",
 
@@ -45,17 +43,36 @@ var cmdBuild = cli.Command{
 			Usage: "A buildpack to use on this app",
 		},
 		cli.StringFlag{
-			Name:  "stack",
-			Usage: "The name of the Heroku stack image to use",
+			Name:  "buildpack-registry",
+			Usage: "The base URL of the buildpack registry",
 		},
-		cli.BoolFlag{
-			Name:  "skip-stack-pull",
-			Usage: "Use a local stack image only",
+		cli.StringFlag{
+			Name:  "stack",
+			Usage: "The name of the stack to build on, from the stack catalog",
 		},
+		pullFlag,
+		skipStackPullFlag,
 		cli.StringSliceFlag{
 			Name:  "env",
 			Usage: "A single environment variable",
 		},
+		envFileFlag,
+		cli.BoolFlag{
+			Name:  "tracked-only",
+			Usage: "Package only the files tracked by git",
+		},
+		cli.BoolFlag{
+			Name:  "reproducible",
+			Usage: "Normalize the app archive and slug so that builds can be compared byte for byte",
+		},
+		cli.BoolFlag{
+			Name:  "offline",
+			Usage: "Use cached buildpacks only, failing if a buildpack isn't cached",
+		},
+		cli.BoolFlag{
+			Name:  "skip-release",
+			Usage: "Don't run the release process from the Procfile after building",
+		},
 		cli.BoolFlag{
 			Name:  "debug",
 			Usage: "Enable debug logging",
@@ -63,6 +80,7 @@ var cmdBuild = cli.Command{
 	},
 
 	Run: func(c *cli.Context) (int, error) {
+		started := time.Now()
 		if len(c.Args) != 2 {
 			fmt.Fprintln(c.App.UserErr, "required arguments: <app directory> <app name>")
 			return cli.ExitStatusInvalidArgs, errors.New("invalid arguments")
@@ -70,22 +88,45 @@ var cmdBuild = cli.Command{
 
 		appDir := filepath.Clean(c.Args[0])
 		appName := filepath.Clean(c.Args[1])
-		buildpacks := c.Flags.StringSlice("buildpack")
-		envVarsList := c.Flags.StringSlice("env")
 		debug := c.Flags.Bool("debug")
 
-		stack := c.Flags.String("stack")
-		if stack == "" {
-			stack = HerokuStack
+		appJSON, err := readAppJSON(appDir)
+		if err != nil {
+			fmt.Fprintln(c.App.UserErr, err.Error())
+			return cli.ExitStatusInvalidArgs, err
+		}
+		herokuConfig, err := readHerokuConfig(appDir)
+		if err != nil {
+			fmt.Fprintln(c.App.UserErr, err.Error())
+			return cli.ExitStatusInvalidArgs, err
+		}
+		userEnvVars, err := loadEnvVars(c, appDir)
+		if err != nil {
+			fmt.Fprintln(c.App.UserErr, err.Error())
+			return cli.ExitStatusInvalidArgs, err
 		}
-		buildStack := BuildStack(stack)
 
-		envVars := make(map[string]string)
-		for _, env := range envVarsList {
-			parts := strings.SplitN(env, "=", 2)
-			name := parts[0]
-			value := parts[1]
-			envVars[name] = value
+		stackName := c.Flags.String("stack")
+		if stackName == "" {
+			stackName = appJSON.Stack
+		}
+		if stackName == "" {
+			stackName = HerokuStack
+		}
+		stack, err := lookupStack(stackName)
+		if err != nil {
+			fmt.Fprintln(c.App.UserErr, err.Error())
+			return cli.ExitStatusInvalidArgs, err
+		}
+		lock, err := heroku.ReadLockfile(appDir)
+		if err != nil {
+			fmt.Fprintln(c.App.UserErr, err.Error())
+			return cli.ExitStatusInvalidArgs, err
+		}
+		pull, err := readPullPolicy(c)
+		if err != nil {
+			fmt.Fprintln(c.App.UserErr, err.Error())
+			return cli.ExitStatusInvalidArgs, err
 		}
 
 		engine, err := docker.New(&engine.EngineConfig{
@@ -96,108 +137,421 @@ var cmdBuild = cli.Command{
 		}
 		defer engine.Close()
 
-		stager := forge.NewStager(engine)
-
-		if !c.Flags.Bool("skip-stack-pull") {
-			err := ui.Loading("Downloading Build Image", engine.NewImage().Pull(buildStack))
-			if err != nil {
-				return cli.ExitStatusUnknownError, err
-			}
+		pinned, err := pinStack(stack, lock, pull, engine.NewImage().Pull)
+		if err != nil {
+			return cli.ExitStatusUnknownError, err
 		}
+		buildStack := pinned.BuildRef()
+		baseRunImage := pinned.RunRef()
 
 		util.WarnIfGitAutoCrlfEnabled()
 
-		herokuConfig, err := heroku.ReadConfig(appDir)
-		if err == nil {
-			if len(herokuConfig.Build.Buildpacks) > 0 {
-				buildpacks = herokuConfig.ResolveBuildpacks()
-			}
-
-			options := buildImageOptions{
-				Debug:   debug,
-				Verbose: true,
-			}
-
-			runDockerfile := herokuConfig.ConstructDockerfile(RunStack)
-			if len(runDockerfile) > 0 {
-				if !c.Flags.Bool("skip-stack-pull") {
-					err := ui.Loading("Downloading Run Image", engine.NewImage().Pull(RunStack))
-					if err != nil {
-						return cli.ExitStatusUnknownError, err
-					}
-				}
-				runImageName := fmt.Sprintf("%s:run", herokuConfig.Id)
-				err = buildImageWithDockerfile(runImageName, runDockerfile, options)
-				if err != nil {
-					return cli.ExitStatusUnknownError, err
-				}
-			}
+		runStack := baseRunImage
+		registry := buildpack.RegistryURL(c.Flags.String("buildpack-registry"), herokuConfig.Build.Registry)
+		buildpacks, err := appBuildpacks(c.Flags.StringSlice("buildpack"), registry, herokuConfig, appJSON)
+		if err != nil {
+			fmt.Fprintln(c.App.UserErr, err.Error())
+			return cli.ExitStatusInvalidArgs, err
+		}
 
-			buildDockerfile := herokuConfig.ConstructDockerfile(buildStack)
-			if len(buildDockerfile) > 0 {
-				buildImageName := fmt.Sprintf("%s:build", herokuConfig.Id)
-				err = buildImageWithDockerfile(buildImageName, buildDockerfile, options)
-				if err != nil {
-					return cli.ExitStatusUnknownError, err
-				}
+		// the images are named after heroku.yml, so apps with the same
+		// heroku.yml share them
+		options := buildImageOptions{
+			Debug:   debug,
+			Verbose: true,
+			Labels:  tataraLabels(""),
+		}
 
-				buildStack = buildImageName
+		runDockerfile := herokuConfig.ConstructDockerfile(baseRunImage)
+		if len(runDockerfile) > 0 {
+			runImageName := fmt.Sprintf("%s:run", herokuConfig.Id)
+			err = buildImageWithDockerfile(runImageName, runDockerfile, options)
+			if err != nil {
+				return cli.ExitStatusUnknownError, err
 			}
+			runStack = runImageName
 		}
 
-		if len(envVars) > 0 {
-			err = applyEnvVars(buildStack, appName, envVars, debug)
+		buildDockerfile := herokuConfig.ConstructDockerfile(buildStack)
+		if len(buildDockerfile) > 0 {
+			buildImageName := fmt.Sprintf("%s:build", herokuConfig.Id)
+			err = buildImageWithDockerfile(buildImageName, buildDockerfile, options)
 			if err != nil {
 				return cli.ExitStatusUnknownError, err
 			}
-			defer cleanUpEnvVarLayer(appName)
-			buildStack = appName
+
+			buildStack = buildImageName
 		}
-		slugPath := fmt.Sprintf("./%s.slug", appName)
-		cachePath := fmt.Sprintf("./.%s.cache", appName)
-		appTar, err := TarApp(appDir)
-		if err != nil {
-			return cli.ExitStatusUnknownError, err
+
+		envVars := buildEnvVars(appJSON, herokuConfig, userEnvVars)
+
+		reproducible := c.Flags.Bool("reproducible")
+		sourceDate, err := heroku.SourceDateEpoch()
+		if reproducible && err != nil {
+			fmt.Fprintln(c.App.UserErr, err.Error())
+			return cli.ExitStatusInvalidArgs, err
 		}
 
+		stager := forge.NewStager(&envDirEngine{Engine: engine, Env: envVars})
 		sysFS := &fs.FS{}
-		cache, cacheSize, err := sysFS.OpenFile(cachePath)
+		staged, err := stageApp(stager, sysFS, &stageOptions{
+			AppDir:       appDir,
+			AppName:      appName,
+			Stack:        stack,
+			BuildStack:   buildStack,
+			Buildpacks:   buildpacks,
+			AppFiles:     appfiles.Options{TrackedOnly: c.Flags.Bool("tracked-only")},
+			Reproducible: reproducible,
+			SourceDate:   sourceDate,
+			Lock:         lock,
+			BuildpackCache: &buildpack.Cache{
+				Dir:     buildpack.DefaultCacheDir(),
+				Offline: c.Flags.Bool("offline"),
+			},
+		})
 		if err != nil {
 			return cli.ExitStatusUnknownError, err
 		}
-		defer cache.Close()
 
-		var app = &forge.AppConfig{
-			Name:       appName,
-			Buildpacks: buildpacks,
-			StagingEnv: map[string]string{
-				"STACK": stack,
-			},
+		slugPath := fmt.Sprintf("./%s.slug", appName)
+		absAppDir, err := filepath.Abs(appDir)
+		if err != nil {
+			return cli.ExitStatusUnknownError, err
 		}
-
-		slug, err := stager.Stage(&forge.StageConfig{
-			AppTar:        appTar,
-			Cache:         cache,
-			CacheEmpty:    cacheSize == 0,
-			BuildpackZips: nil,
-			Stack:         buildStack,
-			Color:         color.GreenString,
-			AppConfig:     app,
-			OutputPath:    "/out/slug.tgz",
-		})
+		err = writeSlugManifest(appDir, slugPath, heroku.SlugManifest{
+			AppDir:      absAppDir,
+			Buildpacks:  staged.Buildpacks,
+			AppChecksum: staged.AppChecksum,
+			Stack: heroku.SlugStack{
+				Name:          stack.Name,
+				ID:            stack.ID,
+				BuildImage:    buildStack,
+				RunImage:      runStack,
+				RunImageLocal: runStack != baseRunImage,
+			},
+			ConfigId: herokuConfig.Id,
+		}, started)
 		if err != nil {
 			return cli.ExitStatusUnknownError, err
 		}
-		defer slug.Close()
 
-		if err := streamOut(*sysFS, slug, slugPath); err != nil {
-			return cli.ExitStatusUnknownError, err
+		if reproducible {
+			manifest, err := heroku.ReadSlugManifest(slugPath)
+			if err != nil {
+				return cli.ExitStatusUnknownError, err
+			}
+			fmt.Println(fmt.Sprintf("App digest: %s", manifest.AppChecksum))
+			fmt.Println(fmt.Sprintf("Slug digest: %s", manifest.Checksum))
+		}
+
+		// the release runs with the config vars of the app at runtime,
+		// rather than the build config vars
+		if !c.Flags.Bool("skip-release") {
+			return runRelease(c, sysFS, slugPath, runtimeOptions{
+				AppName:     appName,
+				AppDir:      appDir,
+				Stack:       runStack,
+				UserEnvVars: userEnvVars,
+				Pull:        pull,
+				PullImage:   engine.NewImage().Pull,
+			})
 		}
 
 		return cli.ExitStatusSuccess, nil
 	},
 }
 
+// appBuildpacks resolves the buildpacks of an app. Buildpacks in heroku.yml
+// take precedence over the --buildpack flags, and the app.json buildpacks
+// are used if neither lists any.
+func appBuildpacks(refs []string, registry string, herokuConfig heroku.Config, appJSON heroku.AppJSON) ([]string, error) {
+	buildpacks := []string{}
+	for _, ref := range refs {
+		url, err := buildpack.Resolve(registry, ref)
+		if err != nil {
+			return nil, err
+		}
+		buildpacks = append(buildpacks, url)
+	}
+	if len(herokuConfig.Build.Buildpacks) > 0 {
+		return herokuConfig.ResolveBuildpacks(registry)
+	}
+	if len(buildpacks) == 0 && len(appJSON.Buildpacks) > 0 {
+		return appJSON.ResolveBuildpacks(registry)
+	}
+	return buildpacks, nil
+}
+
+// buildEnvVars returns the config vars an app is staged with. The env file
+// and flags take precedence over heroku.yml, which takes precedence over the
+// app.json defaults.
+func buildEnvVars(appJSON heroku.AppJSON, herokuConfig heroku.Config, userEnvVars map[string]string) map[string]string {
+	envVars := appJSON.EnvDefaults()
+	for name, value := range herokuConfig.Build.Config {
+		envVars[name] = value
+	}
+	for name, value := range userEnvVars {
+		envVars[name] = value
+	}
+	return envVars
+}
+
+// writeSlugManifest completes the manifest with the details of the slug and
+// writes it next to the slug
+func writeSlugManifest(appDir, slugPath string, manifest heroku.SlugManifest, started time.Time) error {
+	checksum, size, err := heroku.SlugChecksum(slugPath)
+	if err != nil {
+		return err
+	}
+	manifest.Checksum = checksum
+	manifest.Size = size
+
+	manifest.ProcessTypes = map[string]string{}
+	if procfile, err := heroku.ReadSlugProcfile(slugPath); err == nil {
+		for _, process := range procfile {
+			manifest.ProcessTypes[process.Type] = process.Command
+		}
+	}
+
+	manifest.Stack.BuildImageDigest = imageDigest(manifest.Stack.BuildImage)
+	manifest.Stack.RunImageDigest = imageDigest(manifest.Stack.RunImage)
+	manifest.Commit, _ = util.GitCommit(appDir)
+	manifest.CreatedAt = time.Now().UTC()
+	manifest.BuildDuration = time.Since(started).Seconds()
+
+	return heroku.WriteSlugManifest(slugPath, manifest)
+}
+
+// imageDigest returns the repo digest of a local image, or its ID if it was
+// built locally and has no repo digest
+func imageDigest(image string) string {
+	client, err := dockerClient.NewEnvClient()
+	if err != nil {
+		return ""
+	}
+	info, _, err := client.ImageInspectWithRaw(context.Background(), image)
+	if err != nil {
+		return ""
+	}
+	if len(info.RepoDigests) > 0 {
+		return info.RepoDigests[0]
+	}
+	return info.ID
+}
+
+// readAppJSON reads the app.json in appDir, which is optional
+func readAppJSON(appDir string) (heroku.AppJSON, error) {
+	appJSON, err := heroku.ReadAppJSON(appDir)
+	if os.IsNotExist(err) {
+		return appJSON, nil
+	}
+	return appJSON, err
+}
+
+// readHerokuConfig reads the heroku.yml in appDir, which is optional
+func readHerokuConfig(appDir string) (heroku.Config, error) {
+	config, err := heroku.ReadConfig(appDir)
+	if os.IsNotExist(err) {
+		return config, nil
+	}
+	return config, err
+}
+
+type stageOptions struct {
+	AppDir     string
+	AppName    string
+	Stack      heroku.Stack
+	BuildStack string
+	Buildpacks []string
+	AppFiles   appfiles.Options
+
+	// SlugPath and CachePath default to ./<app name>.slug and
+	// ./.<app name>.cache
+	SlugPath  string
+	CachePath string
+
+	// Reproducible builds normalize the app archive and the slug, using
+	// SourceDate for every modification time
+	Reproducible bool
+	SourceDate   time.Time
+
+	BuildpackCache *buildpack.Cache
+	// Lock pins the buildpacks, and is updated with the buildpacks that
+	// were staged with
+	Lock *heroku.Lockfile
+}
+
+type stageResult struct {
+	// Buildpacks are the URLs of the buildpacks that were staged with
+	Buildpacks []string
+	// AppChecksum is the checksum of the app archive of a reproducible build
+	AppChecksum string
+}
+
+// stageApp stages the app on the given build image and writes the resulting
+// slug to the slug path, reusing the cache file.
+func stageApp(stager *forge.Stager, sysFS *fs.FS, options *stageOptions) (*stageResult, error) {
+	appName := options.AppName
+	slugPath := options.SlugPath
+	if slugPath == "" {
+		slugPath = fmt.Sprintf("./%s.slug", appName)
+	}
+	cachePath := options.CachePath
+	if cachePath == "" {
+		cachePath = fmt.Sprintf("./.%s.cache", appName)
+	}
+	cache, cacheSize, err := sysFS.OpenFile(cachePath)
+	if err != nil {
+		return nil, err
+	}
+	defer cache.Close()
+
+	buildpacks, buildpackZips, locked, err := packageBuildpacks(options.Buildpacks, options.BuildpackCache, &options.Lock.Lockfile)
+	if err != nil {
+		return nil, err
+	}
+
+	var app = &forge.AppConfig{
+		Name:       appName,
+		Buildpacks: buildpacks,
+		StagingEnv: map[string]string{
+			"STACK":        options.Stack.Name,
+			"CNB_STACK_ID": options.Stack.ID,
+		},
+	}
+
+	appTar, progress := TarApp(options.AppDir, tarOptions{
+		Files:        options.AppFiles,
+		Reproducible: options.Reproducible,
+		ModTime:      options.SourceDate,
+	})
+	defer appTar.Close()
+	uploaded := make(chan error, 1)
+	go func() {
+		uploaded <- ui.Loading("Uploading app", progress)
+	}()
+	appHasher := sha256.New()
+
+	// the stager reads the whole app before its output starts, so the app
+	// is only read to the end once the upload progress is done
+	appReader := &waitReader{Reader: io.TeeReader(appTar, appHasher), done: uploaded}
+	slug, err := stager.Stage(&forge.StageConfig{
+		AppTar:        appReader,
+		Cache:         cache,
+		CacheEmpty:    cacheSize == 0,
+		BuildpackZips: buildpackZips,
+		Stack:         options.BuildStack,
+		Color:         color.GreenString,
+		AppConfig:     app,
+		OutputPath:    "/out/slug.tgz",
+	})
+	appTar.Close()
+	uploadErr := appReader.Wait()
+	if err != nil {
+		return nil, err
+	}
+	defer slug.Close()
+	if uploadErr != nil {
+		return nil, fmt.Errorf("could not upload app: %s", uploadErr)
+	}
+
+	if err := streamOut(*sysFS, slug, slugPath); err != nil {
+		return nil, err
+	}
+	options.Lock.Lockfile = *locked
+	if options.Lock.Stack != nil || len(locked.Buildpacks) > 0 {
+		if err := options.Lock.Write(options.AppDir); err != nil {
+			return nil, fmt.Errorf("could not write %s: %s", heroku.LockfilePath(options.AppDir), err)
+		}
+	}
+
+	result := &stageResult{Buildpacks: buildpacks}
+	if options.Reproducible {
+		if err := heroku.NormalizeSlug(slugPath, options.SourceDate); err != nil {
+			return nil, fmt.Errorf("could not normalize slug: %s", err)
+		}
+		result.AppChecksum = fmt.Sprintf("SHA256:%x", appHasher.Sum(nil))
+	}
+	return result, nil
+}
+
+// packageBuildpacks packages every buildpack for the stager, so that forge
+// doesn't download them. Remote and git buildpacks are verified against the
+// lockfile. It returns the lockfile for the remote and git buildpacks.
+func packageBuildpacks(buildpacks []string, cache *buildpack.Cache, lock *buildpack.Lockfile) ([]string, map[string]engine.Stream, *buildpack.Lockfile, error) {
+	resolved := make([]string, len(buildpacks))
+	zips := map[string]engine.Stream{}
+	locked := &buildpack.Lockfile{}
+	for i, bp := range buildpacks {
+		url, path, lockEntry, err := fetchBuildpack(bp, cache, lock)
+		if err != nil {
+			return nil, nil, nil, err
+		}
+		if lockEntry != nil {
+			if err := lock.Verify(*lockEntry); err != nil {
+				return nil, nil, nil, err
+			}
+			locked.Lock(*lockEntry)
+		}
+		zip, size, err := buildpack.Zip(path)
+		if err != nil {
+			return nil, nil, nil, fmt.Errorf("could not package buildpack %s: %s", bp, err)
+		}
+		resolved[i] = url
+		zips[buildpack.Key(url)] = engine.NewStream(zip, size)
+	}
+	return resolved, zips, locked, nil
+}
+
+// fetchBuildpack fetches a buildpack into a local directory or archive.
+// Remote buildpacks and git buildpacks are fetched through the cache, and
+// local buildpacks are replaced with their file:// URL. It returns the URL
+// the buildpack is staged with, its path and, unless it is local, its lock
+// entry. Git buildpacks are checked out at the commit they are locked to, if
+// a lockfile is given, rather than at the tip of their ref.
+func fetchBuildpack(bp string, cache *buildpack.Cache, lock *buildpack.Lockfile) (string, string, *buildpack.LockedBuildpack, error) {
+	if repo, ref, ok := buildpack.ParseGitURL(bp); ok {
+		if _, local := buildpack.LocalPath(repo); local && !strings.HasPrefix(repo, "file://") {
+			fileURL, err := buildpack.FileURL(repo)
+			if err != nil {
+				return "", "", nil, err
+			}
+			repo, bp = fileURL, fileURL
+			if ref != "" {
+				bp += "#" + ref
+			}
+		}
+		if lock != nil {
+			if commit := lock.Commit(bp); commit != "" {
+				checkoutDir, err := cache.FetchGitCommit(repo, commit)
+				if err != nil {
+					return "", "", nil, err
+				}
+				return bp, checkoutDir, &buildpack.LockedBuildpack{URL: bp, Commit: commit}, nil
+			}
+		}
+		checkoutDir, commit, err := cache.FetchGit(repo, ref)
+		if err != nil {
+			return "", "", nil, err
+		}
+		return bp, checkoutDir, &buildpack.LockedBuildpack{URL: bp, Commit: commit}, nil
+	}
+
+	if localPath, ok := buildpack.LocalPath(bp); ok {
+		fileURL, err := buildpack.FileURL(localPath)
+		if err != nil {
+			return "", "", nil, err
+		}
+		return fileURL, localPath, nil, nil
+	}
+
+	cachedPath, sha, err := cache.Fetch(bp)
+	if err != nil {
+		return "", "", nil, err
+	}
+	return bp, cachedPath, &buildpack.LockedBuildpack{URL: bp, SHA256: sha}, nil
+}
+
 func streamOut(fs fs.FS, stream engine.Stream, path string) error {
 	file, err := fs.WriteFile(path)
 	if err != nil {
@@ -232,6 +586,8 @@ func buildImageWithDockerfile(appName, dockerfile string, options buildImageOpti
 type buildImageOptions struct {
 	Debug   bool
 	Verbose bool
+	// Labels are set on the image, so that `tatara gc` can find it
+	Labels map[string]string
 }
 
 func buildImage(appName string, dockerContext *bytes.Buffer, options buildImageOptions) error {
@@ -244,6 +600,7 @@ func buildImage(appName string, dockerContext *bytes.Buffer, options buildImageO
 	buildOptions := types.ImageBuildOptions{
 		Tags:       []string{appName},
 		Dockerfile: "Dockerfile",
+		Labels:     options.Labels,
 	}
 	client, err := dockerClient.NewEnvClient()
 	if err != nil {
@@ -271,158 +628,117 @@ func buildImage(appName string, dockerContext *bytes.Buffer, options buildImageO
 	return nil
 }
 
-func createTar(src string) (*bytes.Buffer, error) {
-	buf := new(bytes.Buffer)
-	tw := tar.NewWriter(buf)
-	defer tw.Close()
-
-	err := filepath.Walk(src, func(path string, info os.FileInfo, err error) error {
-		if err != nil {
-			return err
-		}
-
-		header, err := tar.FileInfoHeader(info, info.Name())
-		if err != nil {
-			return err
-		}
-		header.Name = strings.TrimPrefix(strings.Replace(path, src, "", -1), string(filepath.Separator))
-
-		if !info.Mode().IsRegular() {
-			return nil
-		}
+type tarOptions struct {
+	Files appfiles.Options
 
-		err = tw.WriteHeader(header)
-		if err != nil {
-			return err
-		}
+	// Reproducible tars have normalized headers, with ModTime as the
+	// modification time of every entry
+	Reproducible bool
+	ModTime      time.Time
+}
 
-		file, err := os.Open(path)
-		defer file.Close()
-		if err != nil {
-			return err
-		}
+// TarApp streams a tar of the app directory, leaving out ignored files. The
+// tar is written as it is read, so an error walking the directory fails the
+// read. Progress reports the number of files and bytes archived so far.
+func TarApp(path string, options tarOptions) (io.ReadCloser, <-chan engine.Progress) {
+	reader, writer := io.Pipe()
+	progress := make(chan engine.Progress, 1)
+	go func() {
+		defer close(progress)
+		counter := &countingWriter{Writer: writer}
+		files := 0
+		lastUpdate := time.Now()
+		err := writeAppTar(counter, path, options, func() {
+			files++
+			if time.Since(lastUpdate) >= 100*time.Millisecond {
+				lastUpdate = time.Now()
+				sendProgress(progress, tarProgress{files: files, size: counter.size})
+			}
+		})
+		writer.CloseWithError(err)
 
-		_, err = io.Copy(tw, file)
-		if err != nil {
-			return err
+		// the final status replaces any update that wasn't read yet
+		select {
+		case <-progress:
+		default:
 		}
-
-		return nil
-	})
-
-	return buf, err
+		progress <- tarProgress{files: files, size: counter.size, err: err}
+	}()
+	return reader, progress
 }
 
-func applyEnvVars(stack string, newStack string, env map[string]string, debug bool) error {
-	tmpDir, err := ioutil.TempDir("", "")
-	if err != nil {
-		return err
-	}
-	defer os.Remove(tmpDir)
-
-	envDir := fmt.Sprintf("%s/env", tmpDir)
-	err = os.Mkdir(envDir, 0755)
-	if err != nil {
-		return err
-	}
-
-	for name, value := range env {
-		filePath := fmt.Sprintf("%s/%s/%s", tmpDir, "env", name)
-		ioutil.WriteFile(filePath, []byte(value), 0644)
-	}
-	dockerEnvDir := "/tmp/env"
-	dockerfile := fmt.Sprintf(`FROM %s
-COPY env %s
-`, stack, dockerEnvDir)
-	filePath := fmt.Sprintf("%s/Dockerfile", tmpDir)
-	ioutil.WriteFile(filePath, []byte(dockerfile), 0644)
-
-	tarball, err := createTar(tmpDir)
-	if err != nil {
-		return err
-	}
-
-	options := buildImageOptions{
-		Debug:   debug,
-		Verbose: false,
-	}
+// waitReader holds back the end of a reader until done receives, so that
+// whatever reports on the reading has finished
+type waitReader struct {
+	io.Reader
+	done <-chan error
 
-	return buildImage(newStack, tarball, options)
+	waited bool
+	err    error
 }
 
-func cleanUpEnvVarLayer(stack string) error {
-	client, err := dockerClient.NewEnvClient()
-	if err != nil {
-		fmt.Printf("Couldn't remove Env Var layer: %s", err.Error())
-		return err
-	}
-
-	removeOptions := types.ImageRemoveOptions{
-		Force: true,
+func (r *waitReader) Read(p []byte) (int, error) {
+	n, err := r.Reader.Read(p)
+	if err == io.EOF {
+		r.Wait()
 	}
+	return n, err
+}
 
-	_, err = client.ImageRemove(context.Background(), stack, removeOptions)
-	if err != nil {
-		fmt.Printf("Couldn't remove Env Var layer: %s", err.Error())
-		return err
+// Wait waits for done and returns the error it received
+func (r *waitReader) Wait() error {
+	if !r.waited {
+		r.err = <-r.done
+		r.waited = true
 	}
-
-	return nil
+	return r.err
 }
 
-// copide mostly from https://medium.com/@skdomino/taring-untaring-files-in-go-6b07cf56bc07
-func TarApp(path string) (io.Reader, error) {
-	var buf bytes.Buffer
-	tarWriter := tar.NewWriter(&buf)
-	defer tarWriter.Close()
+// copied mostly from https://medium.com/@skdomino/taring-untaring-files-in-go-6b07cf56bc07
+func writeAppTar(w io.Writer, path string, options tarOptions, onFile func()) error {
+	tarWriter := tar.NewWriter(w)
 
-	gitignore, gitignoreErr := ignore.CompileIgnoreFile(fmt.Sprintf("%s/.gitignore", path))
-	slugignore, slugignoreErr := ignore.CompileIgnoreFile(fmt.Sprintf("%s/.slugignore", path))
-
-	err := filepath.Walk(path, func(file string, fileInfo os.FileInfo, err error) error {
-		if err != nil {
-			return err
-		}
-
-		relpath, err := filepath.Rel(path, file)
-		if err != nil {
-			return err
-		}
-
-		// need to append "/" to directories, so directories will get ignored
-		// if the user lists a "/" at the end of their directory
-		if dirInfo, err := os.Stat(file); err != nil {
-			return err
-		} else if dirInfo.IsDir() {
-			relpath += "/"
-		}
-
-		excludes := []string{`^.+\.slug$`, `^\..+\.cache$`}
-		for _, excludePattern := range excludes {
-			if regexp.MustCompile(excludePattern).MatchString(relpath) {
-				return nil
-			}
-		}
-
-		if gitignoreErr == nil && gitignore.MatchesPath(relpath) {
+	// entries are written in lexical order, since Walk visits files in that
+	// order
+	err := appfiles.Walk(path, options.Files, func(file, relPath string, fileInfo os.FileInfo) error {
+		if appfiles.Special(fileInfo) {
+			fmt.Fprintln(os.Stderr, fmt.Sprintf("Warning: skipping %s, it is a %s", relPath, appfiles.Describe(fileInfo)))
 			return nil
 		}
 
-		if slugignoreErr == nil && slugignore.MatchesPath(relpath) {
-			return nil
+		// symlinks are archived as links, not as the files they point to
+		link := ""
+		if fileInfo.Mode()&os.ModeSymlink != 0 {
+			var err error
+			link, err = os.Readlink(file)
+			if err != nil {
+				return err
+			}
 		}
 
-		header, err := tar.FileInfoHeader(fileInfo, fileInfo.Name())
+		// the header keeps the permission bits, including executable bits
+		header, err := tar.FileInfoHeader(fileInfo, link)
 		if err != nil {
 			return err
 		}
-
-		header.Name = strings.TrimPrefix(strings.Replace(file, path, "", -1), string(filepath.Separator))
+		header.Name = relPath
+		if fileInfo.IsDir() {
+			header.Name += "/"
+		}
+		if options.Reproducible {
+			heroku.NormalizeHeader(header, options.ModTime)
+			// the app files belong to whoever runs tatara, so reproducible
+			// archives give them to a fixed owner, uid and gid 0
+			header.Uid, header.Gid = 0, 0
+			header.Uname, header.Gname = "", ""
+		}
 
 		if err := tarWriter.WriteHeader(header); err != nil {
 			return err
 		}
 
+		onFile()
+
 		if !fileInfo.Mode().IsRegular() {
 			return nil
 		}
@@ -431,15 +747,44 @@ func TarApp(path string) (io.Reader, error) {
 		if err != nil {
 			return err
 		}
+		defer f.Close()
 
-		if _, err := io.Copy(tarWriter, f); err != nil {
-			return err
-		}
+		_, err = io.Copy(tarWriter, f)
+		return err
+	})
+	if err != nil {
+		return err
+	}
 
-		f.Close()
+	return tarWriter.Close()
+}
 
-		return nil
-	})
+type countingWriter struct {
+	io.Writer
+	size int64
+}
 
-	return &buf, err
+func (c *countingWriter) Write(p []byte) (int, error) {
+	n, err := c.Writer.Write(p)
+	c.size += int64(n)
+	return n, err
+}
+
+type tarProgress struct {
+	files int
+	size  int64
+	err   error
+}
+
+func (p tarProgress) Status() (string, error) {
+	return fmt.Sprintf("%d files, %.1f MB", p.files, float64(p.size)/1024/1024), p.err
+}
+
+// sendProgress drops updates that the reader isn't ready for, so that
+// archiving never waits on the progress display
+func sendProgress(progress chan<- engine.Progress, p tarProgress) {
+	select {
+	case progress <- p:
+	default:
+	}
 }
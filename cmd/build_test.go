@@ -0,0 +1,122 @@
+package main
+
+import (
+	"crypto/sha256"
+	"errors"
+	"fmt"
+	"io"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/buildpack/forge/engine"
+	"github.com/stretchr/testify/assert"
+)
+
+func writeTestApp(t *testing.T, dir string, files map[string]string) {
+	for name, contents := range files {
+		path := filepath.Join(dir, filepath.FromSlash(name))
+		assert.Nil(t, os.MkdirAll(filepath.Dir(path), 0777))
+		assert.Nil(t, ioutil.WriteFile(path, []byte(contents), 0666))
+	}
+}
+
+func tarDigest(t *testing.T, dir string, options tarOptions) string {
+	reader, progress := TarApp(dir, options)
+	defer reader.Close()
+	hash := sha256.New()
+	_, err := io.Copy(hash, reader)
+	assert.Nil(t, err)
+	for p := range progress {
+		_, err := p.Status()
+		assert.Nil(t, err)
+	}
+	return fmt.Sprintf("%x", hash.Sum(nil))
+}
+
+func TestTarAppReproducible(t *testing.T) {
+	dir, err := ioutil.TempDir("", "app")
+	assert.Nil(t, err)
+	defer os.RemoveAll(dir)
+
+	writeTestApp(t, dir, map[string]string{
+		"Procfile":   "web: ruby app.rb\n",
+		"app.rb":     "puts 'hello'\n",
+		"lib/lib.rb": "",
+	})
+	options := tarOptions{Reproducible: true, ModTime: time.Date(2018, 1, 1, 0, 0, 0, 0, time.UTC)}
+	first := tarDigest(t, dir, options)
+
+	// a build leaves its outputs in the app directory, and touches the app
+	// files
+	writeTestApp(t, dir, map[string]string{
+		"myapp.slug":      "slug",
+		"myapp.slug.json": `{"app": "myapp"}`,
+		"myapp.slug.tmp":  "slug",
+		".slug-tar-1234":  "tar",
+		".myapp.cache":    "cache",
+		"tatara.lock":     "{}",
+	})
+	later := time.Now().Add(time.Hour)
+	assert.Nil(t, os.Chtimes(filepath.Join(dir, "app.rb"), later, later))
+
+	assert.Equal(t, first, tarDigest(t, dir, options))
+}
+
+func TestWaitReader(t *testing.T) {
+	done := make(chan error, 1)
+	reader := &waitReader{Reader: strings.NewReader("app"), done: done}
+
+	read := make(chan []byte)
+	go func() {
+		contents, _ := ioutil.ReadAll(reader)
+		read <- contents
+	}()
+	select {
+	case <-read:
+		t.Fatal("read to the end before done")
+	case <-time.After(50 * time.Millisecond):
+	}
+
+	done <- errors.New("upload failed")
+	assert.Equal(t, []byte("app"), <-read)
+	assert.EqualError(t, reader.Wait(), "upload failed")
+}
+
+func TestTarAppProgress(t *testing.T) {
+	dir, err := ioutil.TempDir("", "app")
+	assert.Nil(t, err)
+	defer os.RemoveAll(dir)
+
+	writeTestApp(t, dir, map[string]string{
+		"Procfile":   "web: ruby app.rb\n",
+		"app.rb":     "puts 'hello'\n",
+		"lib/lib.rb": "",
+	})
+	reader, progress := TarApp(dir, tarOptions{})
+	_, err = io.Copy(ioutil.Discard, reader)
+	assert.Nil(t, err)
+	reader.Close()
+
+	var last engine.Progress
+	for p := range progress {
+		last = p
+	}
+	status, err := last.Status()
+	assert.Nil(t, err)
+	// Procfile, app.rb, lib and lib/lib.rb
+	assert.Regexp(t, `^4 files, 0\.0 MB$`, status)
+
+	reader, progress = TarApp(filepath.Join(dir, "missing"), tarOptions{})
+	_, err = io.Copy(ioutil.Discard, reader)
+	assert.NotNil(t, err)
+	reader.Close()
+	for p := range progress {
+		last = p
+	}
+	_, err = last.Status()
+	assert.NotNil(t, err)
+}
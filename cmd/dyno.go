@@ -0,0 +1,311 @@
+package main
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"io"
+	"net"
+	"sort"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/buildpack/forge"
+	"github.com/buildpack/forge/engine"
+	"github.com/docker/docker/api/types"
+	"github.com/docker/docker/api/types/container"
+	"github.com/docker/docker/api/types/events"
+	"github.com/docker/docker/api/types/filters"
+	dockerClient "github.com/docker/docker/client"
+)
+
+const (
+	dynoBootTimeout   = 60 * time.Second
+	dynoShutdownGrace = 30 * time.Second
+	dynoMemoryWarning = 20 * time.Second
+)
+
+const megabyte = 1024 * 1024
+
+type dynoSize struct {
+	// Quota is the memory a dyno may use before logging R14 errors
+	Quota int64
+	// Limit is the memory at which a dyno is killed with an R15 error
+	Limit int64
+}
+
+var dynoSizes = map[string]dynoSize{
+	"standard-1x":   {Quota: 512 * megabyte, Limit: 1024 * megabyte},
+	"standard-2x":   {Quota: 1024 * megabyte, Limit: 2048 * megabyte},
+	"performance-m": {Quota: 2560 * megabyte, Limit: 2560 * megabyte},
+	"performance-l": {Quota: 14336 * megabyte, Limit: 14336 * megabyte},
+}
+
+func dynoSizeNames() []string {
+	var names []string
+	for name := range dynoSizes {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	return names
+}
+
+// dynoManager emulates the dyno manager for the containers forge starts from
+// an image: it applies memory limits, enforces the boot timeout and stops
+// dynos gracefully. Only the containers created through its Engine are
+// managed, so that other runs of the same image are left alone.
+type dynoManager struct {
+	client *dockerClient.Client
+	size   *dynoSize
+	// ports holds the host port each web dyno has to bind within the boot timeout
+	ports  map[string]int
+	hostIP string
+	logs   io.Writer
+	cancel context.CancelFunc
+
+	lock    sync.Mutex
+	owned   map[string]bool
+	dynos   map[string]string
+	logLock sync.Mutex
+}
+
+func startDynoManager(image string, size *dynoSize, hostIP string, ports map[string]int, logs io.Writer) (*dynoManager, error) {
+	client, err := dockerClient.NewEnvClient()
+	if err != nil {
+		return nil, err
+	}
+
+	ctx, cancel := context.WithCancel(context.Background())
+	m := &dynoManager{
+		client: client,
+		size:   size,
+		ports:  ports,
+		hostIP: hostIP,
+		logs:   logs,
+		cancel: cancel,
+		owned:  map[string]bool{},
+		dynos:  map[string]string{},
+	}
+
+	args := filters.NewArgs()
+	args.Add("type", "container")
+	args.Add("event", "start")
+	args.Add("event", "oom")
+	args.Add("event", "die")
+	args.Add("image", image)
+	messages, errs := client.Events(ctx, types.EventsOptions{Filters: args})
+
+	go func() {
+		for {
+			select {
+			case msg := <-messages:
+				m.handle(ctx, msg)
+			case <-errs:
+				return
+			}
+		}
+	}()
+
+	return m, nil
+}
+
+func (m *dynoManager) handle(ctx context.Context, msg events.Message) {
+	switch msg.Action {
+	case "start":
+		m.lock.Lock()
+		owned := m.owned[msg.Actor.ID]
+		m.lock.Unlock()
+		if !owned {
+			return
+		}
+		info, err := m.client.ContainerInspect(ctx, msg.Actor.ID)
+		if err != nil {
+			return
+		}
+		name := "web.1"
+		for _, env := range info.Config.Env {
+			if strings.HasPrefix(env, "DYNO=") {
+				name = strings.TrimPrefix(env, "DYNO=")
+			}
+		}
+
+		m.lock.Lock()
+		m.dynos[msg.Actor.ID] = name
+		m.lock.Unlock()
+
+		m.log(name, "Starting process")
+		if m.size != nil {
+			go m.watchMemory(ctx, msg.Actor.ID, name)
+		}
+		if port, ok := m.ports[name]; ok {
+			go m.watchBoot(ctx, msg.Actor.ID, name, port)
+		}
+	case "oom":
+		if name, ok := m.dyno(msg.Actor.ID); ok {
+			m.log(name, "Error R15 (Memory quota vastly exceeded)")
+			m.log(name, "Stopping process with SIGKILL")
+		}
+	case "die":
+		if name, ok := m.dyno(msg.Actor.ID); ok {
+			m.log(name, "Process exited with status %s", msg.Actor.Attributes["exitCode"])
+			m.lock.Lock()
+			delete(m.dynos, msg.Actor.ID)
+			delete(m.owned, msg.Actor.ID)
+			m.lock.Unlock()
+		}
+	}
+}
+
+// Engine returns an engine that creates containers managed by m
+func (m *dynoManager) Engine(e forge.Engine) forge.Engine {
+	return &dynoEngine{Engine: e, manager: m}
+}
+
+// dynoEngine records the containers forge creates for a run and applies the
+// dyno size to them, before they are started
+type dynoEngine struct {
+	forge.Engine
+	manager *dynoManager
+}
+
+func (e *dynoEngine) NewContainer(config *engine.ContainerConfig) (engine.Container, error) {
+	ctr, err := e.Engine.NewContainer(config)
+	if err != nil {
+		return ctr, err
+	}
+	if size := e.manager.size; size != nil {
+		_, err := e.manager.client.ContainerUpdate(context.Background(), ctr.ID(), container.UpdateConfig{
+			Resources: container.Resources{
+				Memory:     size.Limit,
+				MemorySwap: size.Limit,
+			},
+		})
+		if err != nil {
+			ctr.Close()
+			return nil, fmt.Errorf("could not apply dyno size: %s", err)
+		}
+	}
+	e.manager.lock.Lock()
+	e.manager.owned[ctr.ID()] = true
+	e.manager.lock.Unlock()
+	return ctr, nil
+}
+
+func (m *dynoManager) dyno(id string) (string, bool) {
+	m.lock.Lock()
+	defer m.lock.Unlock()
+	name, ok := m.dynos[id]
+	return name, ok
+}
+
+// watchBoot kills a web dyno that does not bind its port in time, like R10
+func (m *dynoManager) watchBoot(ctx context.Context, id, name string, port int) {
+	timeout := time.After(dynoBootTimeout)
+	addr := fmt.Sprintf("%s:%d", m.hostIP, port)
+	for {
+		if portBound(addr) {
+			m.log(name, "State changed from starting to up")
+			return
+		}
+		select {
+		case <-ctx.Done():
+			return
+		case <-timeout:
+			if _, ok := m.dyno(id); !ok {
+				return
+			}
+			m.log(name, "Error R10 (Boot timeout) -> Web process failed to bind to $PORT within %d seconds of launch", int(dynoBootTimeout.Seconds()))
+			m.log(name, "Stopping process with SIGKILL")
+			m.client.ContainerKill(ctx, id, "SIGKILL")
+			return
+		case <-time.After(time.Second):
+		}
+	}
+}
+
+// portBound reports whether a process is listening behind addr. Docker's
+// userland proxy accepts connections for unbound ports but closes them
+// immediately, so a connection that stays open is treated as bound.
+func portBound(addr string) bool {
+	conn, err := net.DialTimeout("tcp", addr, time.Second)
+	if err != nil {
+		return false
+	}
+	defer conn.Close()
+	conn.SetReadDeadline(time.Now().Add(500 * time.Millisecond))
+	_, err = conn.Read(make([]byte, 1))
+	if netErr, ok := err.(net.Error); ok && netErr.Timeout() {
+		return true
+	}
+	return err == nil
+}
+
+// watchMemory logs R14 errors while a dyno uses more than its memory quota
+func (m *dynoManager) watchMemory(ctx context.Context, id, name string) {
+	stats, err := m.client.ContainerStats(ctx, id, true)
+	if err != nil {
+		return
+	}
+	defer stats.Body.Close()
+
+	var lastWarning time.Time
+	decoder := json.NewDecoder(stats.Body)
+	for {
+		var s types.StatsJSON
+		if err := decoder.Decode(&s); err != nil {
+			return
+		}
+		usage := int64(s.MemoryStats.Usage)
+		if usage > m.size.Quota && time.Since(lastWarning) > dynoMemoryWarning {
+			lastWarning = time.Now()
+			m.log(name, "Process running mem=%dM(%.1f%%)", usage/megabyte, float64(usage)*100/float64(m.size.Quota))
+			m.log(name, "Error R14 (Memory quota exceeded)")
+		}
+	}
+}
+
+// Exit returns a channel that is closed once exit is closed and every dyno
+// has been stopped.
+func (m *dynoManager) Exit(exit <-chan struct{}) <-chan struct{} {
+	stopped := make(chan struct{})
+	go func() {
+		<-exit
+		m.Stop()
+		close(stopped)
+	}()
+	return stopped
+}
+
+// Stop sends SIGTERM to every dyno and waits until each one has exited or
+// has been killed at the end of the grace period.
+func (m *dynoManager) Stop() {
+	m.lock.Lock()
+	dynos := map[string]string{}
+	for id, name := range m.dynos {
+		dynos[id] = name
+	}
+	m.lock.Unlock()
+
+	var wg sync.WaitGroup
+	for id, name := range dynos {
+		m.log(name, "Stopping all processes with SIGTERM")
+		wg.Add(1)
+		go func(id string) {
+			defer wg.Done()
+			grace := dynoShutdownGrace
+			m.client.ContainerStop(context.Background(), id, &grace)
+		}(id)
+	}
+	wg.Wait()
+}
+
+func (m *dynoManager) Close() {
+	m.cancel()
+}
+
+func (m *dynoManager) log(name, format string, a ...interface{}) {
+	m.logLock.Lock()
+	defer m.logLock.Unlock()
+	fmt.Fprintf(m.logs, "heroku[%s]: %s\n", name, fmt.Sprintf(format, a...))
+}
@@ -0,0 +1,75 @@
+package main
+
+import (
+	"context"
+	"os"
+	"testing"
+
+	"github.com/buildpack/forge"
+	"github.com/buildpack/forge/engine"
+	"github.com/docker/docker/api/types/events"
+	dockerClient "github.com/docker/docker/client"
+	"github.com/stretchr/testify/assert"
+)
+
+type testEngine struct {
+	forge.Engine
+	ids    []string
+	closed bool
+}
+
+func (e *testEngine) NewContainer(config *engine.ContainerConfig) (engine.Container, error) {
+	id := e.ids[0]
+	e.ids = e.ids[1:]
+	return testContainer{id: id, closed: &e.closed}, nil
+}
+
+type testContainer struct {
+	engine.Container
+	id     string
+	closed *bool
+}
+
+func (c testContainer) ID() string {
+	return c.id
+}
+
+func (c testContainer) Close() error {
+	*c.closed = true
+	return nil
+}
+
+func TestDynoManagerEngine(t *testing.T) {
+	m := &dynoManager{owned: map[string]bool{}, dynos: map[string]string{}}
+	e := m.Engine(&testEngine{ids: []string{"abc", "def"}})
+
+	container, err := e.NewContainer(&engine.ContainerConfig{})
+	assert.Nil(t, err)
+	assert.Equal(t, "abc", container.ID())
+	_, err = e.NewContainer(&engine.ContainerConfig{})
+	assert.Nil(t, err)
+
+	assert.Equal(t, map[string]bool{"abc": true, "def": true}, m.owned)
+
+	// containers of other runs are left alone
+	m.handle(context.Background(), events.Message{Action: "start", Actor: events.Actor{ID: "other"}})
+	assert.Empty(t, m.dynos)
+}
+
+func TestDynoManagerEngineSize(t *testing.T) {
+	os.Setenv("DOCKER_HOST", "tcp://127.0.0.1:1")
+	defer os.Unsetenv("DOCKER_HOST")
+	client, err := dockerClient.NewEnvClient()
+	assert.Nil(t, err)
+
+	size := dynoSizes["standard-1x"]
+	m := &dynoManager{client: client, size: &size, owned: map[string]bool{}}
+	testEngine := &testEngine{ids: []string{"abc"}}
+	e := m.Engine(testEngine)
+
+	// a dyno is never started without its memory limit
+	_, err = e.NewContainer(&engine.ContainerConfig{})
+	assert.Contains(t, err.Error(), "could not apply dyno size")
+	assert.True(t, testEngine.closed)
+	assert.Empty(t, m.owned)
+}
@@ -0,0 +1,128 @@
+package main
+
+import (
+	"archive/tar"
+	"bytes"
+	"fmt"
+	"os"
+	"path/filepath"
+	"strings"
+
+	"github.com/buildpack/forge"
+	"github.com/buildpack/forge/engine"
+	"github.com/heroku/tatara/cli"
+	"github.com/heroku/tatara/heroku"
+)
+
+var envFileFlag = cli.StringFlag{
+	Name:  "env-file",
+	Usage: "A file of environment variables (defaults to .env in the app directory)",
+}
+
+// parseEnvVars turns a list of NAME=VALUE flags into a map
+func parseEnvVars(envVarsList []string) (map[string]string, error) {
+	envVars := make(map[string]string)
+	for _, env := range envVarsList {
+		parts := strings.SplitN(env, "=", 2)
+		if len(parts) != 2 || parts[0] == "" {
+			return nil, fmt.Errorf("invalid environment variable %q, expected NAME=VALUE", env)
+		}
+		if !heroku.ValidEnvVarName(parts[0]) {
+			return nil, fmt.Errorf("invalid environment variable name %q", parts[0])
+		}
+		envVars[parts[0]] = parts[1]
+	}
+	return envVars, nil
+}
+
+// loadEnvVars reads the --env-file, or the .env file in appDir if there is
+// one, and layers the --env flags over it
+func loadEnvVars(c *cli.Context, appDir string) (map[string]string, error) {
+	envVars := map[string]string{}
+	envFile := c.Flags.String("env-file")
+	if envFile == "" {
+		envFile = filepath.Join(appDir, ".env")
+		if _, err := os.Stat(envFile); os.IsNotExist(err) {
+			envFile = ""
+		}
+	}
+	if envFile != "" {
+		fileVars, err := heroku.ReadEnvFile(envFile)
+		if err != nil {
+			return nil, err
+		}
+		envVars = fileVars
+	}
+
+	flagVars, err := parseEnvVars(c.Flags.StringSlice("env"))
+	if err != nil {
+		return nil, err
+	}
+	for name, value := range flagVars {
+		envVars[name] = value
+	}
+	return envVars, nil
+}
+
+// buildEnvDir is where buildpacks find the build config vars, one file per
+// variable, through the ENV_DIR argument of bin/compile
+const buildEnvDir = "/tmp/env"
+
+// envDirEngine extracts the build config vars into buildEnvDir of every
+// container the stager creates. They are streamed from an in-memory tar, so
+// that they never end up in an image layer.
+type envDirEngine struct {
+	forge.Engine
+	Env map[string]string
+}
+
+func (e *envDirEngine) NewContainer(config *engine.ContainerConfig) (engine.Container, error) {
+	container, err := e.Engine.NewContainer(config)
+	if err != nil || len(e.Env) == 0 {
+		return container, err
+	}
+
+	envTar, err := envDirTar(filepath.Base(buildEnvDir), e.Env)
+	if err != nil {
+		container.Close()
+		return nil, err
+	}
+	if err := container.ExtractTo(envTar, filepath.Dir(buildEnvDir)); err != nil {
+		container.Close()
+		return nil, fmt.Errorf("could not copy build config vars: %s", err)
+	}
+	return container, nil
+}
+
+// envDirTar returns a tar of a directory with a file for every variable
+func envDirTar(dir string, env map[string]string) (*bytes.Buffer, error) {
+	buf := &bytes.Buffer{}
+	tw := tar.NewWriter(buf)
+	err := tw.WriteHeader(&tar.Header{
+		Typeflag: tar.TypeDir,
+		Name:     dir + "/",
+		Mode:     0755,
+	})
+	if err != nil {
+		return nil, err
+	}
+	for name, value := range env {
+		// every variable is a file directly in the directory
+		if name == "" || name == "." || name == ".." || strings.Contains(name, "/") {
+			return nil, fmt.Errorf("invalid build config var name %q", name)
+		}
+		err := tw.WriteHeader(&tar.Header{
+			Typeflag: tar.TypeReg,
+			Name:     dir + "/" + name,
+			Mode:     0644,
+			Size:     int64(len(value)),
+		})
+		if err != nil {
+			return nil, err
+		}
+		if _, err := tw.Write([]byte(value)); err != nil {
+			return nil, err
+		}
+	}
+	return buf, tw.Close()
+}
@@ -0,0 +1,66 @@
+package main
+
+import (
+	"archive/tar"
+	"fmt"
+	"io"
+	"io/ioutil"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestEnvDirTar(t *testing.T) {
+	buf, err := envDirTar("env", map[string]string{
+		"RAILS_ENV": "production",
+		"EMPTY":     "",
+		"MULTILINE": "line 1\nline 2\n",
+	})
+	assert.Nil(t, err)
+
+	files := map[string]string{}
+	tr := tar.NewReader(buf)
+	header, err := tr.Next()
+	assert.Nil(t, err)
+	assert.Equal(t, "env/", header.Name)
+	assert.Equal(t, byte(tar.TypeDir), header.Typeflag)
+	assert.Equal(t, int64(0755), header.Mode)
+	for {
+		header, err := tr.Next()
+		if err == io.EOF {
+			break
+		}
+		assert.Nil(t, err)
+		assert.Equal(t, byte(tar.TypeReg), header.Typeflag)
+		assert.Equal(t, int64(0644), header.Mode)
+		contents, err := ioutil.ReadAll(tr)
+		assert.Nil(t, err)
+		files[header.Name] = string(contents)
+	}
+	assert.Equal(t, map[string]string{
+		"env/RAILS_ENV": "production",
+		"env/EMPTY":     "",
+		"env/MULTILINE": "line 1\nline 2\n",
+	}, files)
+}
+
+func TestEnvDirTarInvalidNames(t *testing.T) {
+	for _, name := range []string{"../../etc/x", "a/b", "..", ""} {
+		_, err := envDirTar("env", map[string]string{name: "1"})
+		assert.EqualError(t, err, fmt.Sprintf("invalid build config var name %q", name))
+	}
+}
+
+func TestParseEnvVars(t *testing.T) {
+	env, err := parseEnvVars([]string{"RAILS_ENV=production", "EMPTY=", "URL=a=b"})
+	assert.Nil(t, err)
+	assert.Equal(t, map[string]string{"RAILS_ENV": "production", "EMPTY": "", "URL": "a=b"}, env)
+
+	_, err = parseEnvVars([]string{"RAILS_ENV"})
+	assert.EqualError(t, err, `invalid environment variable "RAILS_ENV", expected NAME=VALUE`)
+
+	for _, name := range []string{"../../etc/x", "a/b", "1ABC", "A-B"} {
+		_, err = parseEnvVars([]string{name + "=1"})
+		assert.EqualError(t, err, fmt.Sprintf("invalid environment variable name %q", name))
+	}
+}
@@ -4,15 +4,12 @@ import (
 	"errors"
 	"fmt"
 	"path/filepath"
-	"os"
 
 	"github.com/buildpack/forge"
 	"github.com/buildpack/forge/engine"
 	"github.com/buildpack/forge/engine/docker"
 	"github.com/heroku/tatara/cli"
 	"github.com/heroku/tatara/fs"
-	"github.com/heroku/tatara/ui"
-	"github.com/heroku/tatara/heroku"
 )
 
 var cmdExport = cli.Command{
@@ -21,16 +18,14 @@ var cmdExport = cli.Command{
 	Flags: []cli.Flag{
 		cli.StringFlag{
 			Name:  "stack",
-			Usage: "The name of the packs stack image to use",
+			Usage: "The stack or run image to use (defaults to the run image of the build)",
 		},
 		cli.StringFlag{
 			Name:  "tag",
 			Usage: "Tag name to use for the docker image (defaults to app name)",
 		},
-		cli.BoolFlag{
-			Name:  "skip-stack-pull",
-			Usage: "Use a local stack image only",
-		},
+		pullFlag,
+		skipStackPullFlag,
 		cli.BoolFlag{
 			Name:  "debug",
 			Usage: "Enable debug logging",
@@ -46,11 +41,6 @@ var cmdExport = cli.Command{
 		appName := filepath.Clean(c.Args[0])
 		debug := c.Flags.Bool("debug")
 
-		stack := c.Flags.String("stack")
-		if stack == "" {
-			stack = RunStack
-		}
-
 		tag := c.Flags.String("tag")
 		if tag == "" {
 			tag = appName
@@ -67,6 +57,16 @@ var cmdExport = cli.Command{
 		slug := engine.NewStream(slugFile, slugSize)
 		defer slug.Close()
 
+		manifest, err := readSlugManifest(slugFilename)
+		if err != nil {
+			fmt.Fprintln(c.App.UserErr, err.Error())
+			return cli.ExitStatusInvalidArgs, err
+		}
+		stack, localStack := slugRunImage(manifest, c.Flags.String("stack"))
+		if debug {
+			fmt.Println(fmt.Sprintf("Using image: %s", stack))
+		}
+
 		engine, err := docker.New(&engine.EngineConfig{
 			Exit: c.Exit,
 		})
@@ -75,27 +75,17 @@ var cmdExport = cli.Command{
 		}
 		defer engine.Close()
 
-		if !c.Flags.Bool("skip-stack-pull") {
-			err := ui.Loading("Downloading Runtime Image", engine.NewImage().Pull(stack))
-			if err != nil {
-				return cli.ExitStatusUnknownError, err
-			}
+		pull, err := readPullPolicy(c)
+		if err != nil {
+			fmt.Fprintln(c.App.UserErr, err.Error())
+			return cli.ExitStatusInvalidArgs, err
 		}
-
-		curDir, err := os.Getwd()
+		err = prepareRunImage(stack, localStack, pull, engine.NewImage().Pull)
 		if err != nil {
+			fmt.Fprintln(c.App.UserErr, err.Error())
 			return cli.ExitStatusUnknownError, err
 		}
 
-		herokuConfig, err := heroku.ReadConfig(curDir)
-		if err == nil {
-			imageName := fmt.Sprintf("%s:run", herokuConfig.Id)
-			if debug {
-				fmt.Println(fmt.Sprintf("Using image: %s", imageName))
-			}
-			stack = imageName
-		}
-
 		exporter := forge.NewExporter(engine)
 
 		id, err := exporter.Export(&forge.ExportConfig{
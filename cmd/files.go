@@ -0,0 +1,55 @@
+package main
+
+import (
+	"errors"
+	"fmt"
+	"os"
+	"path/filepath"
+
+	"github.com/heroku/tatara/appfiles"
+	"github.com/heroku/tatara/cli"
+)
+
+var cmdFiles = cli.Command{
+	Name: "files",
+
+	Flags: []cli.Flag{
+		cli.BoolFlag{
+			Name:  "tracked-only",
+			Usage: "List only the files tracked by git",
+		},
+	},
+
+	Run: func(c *cli.Context) (int, error) {
+		if len(c.Args) != 1 {
+			fmt.Fprintln(c.App.UserErr, "required arguments: <app directory>")
+			return cli.ExitStatusInvalidArgs, errors.New("invalid arguments")
+		}
+
+		appDir := filepath.Clean(c.Args[0])
+		options := appfiles.Options{TrackedOnly: c.Flags.Bool("tracked-only")}
+
+		files := 0
+		var size int64
+		err := appfiles.Walk(appDir, options, func(file, relPath string, info os.FileInfo) error {
+			if info.IsDir() {
+				return nil
+			}
+			if appfiles.Special(info) {
+				fmt.Fprintln(c.App.UserErr, fmt.Sprintf("Warning: skipping %s, it is a %s", relPath, appfiles.Describe(info)))
+				return nil
+			}
+			files++
+			size += info.Size()
+			fmt.Fprintln(c.App.UserOut, relPath)
+			return nil
+		})
+		if err != nil {
+			fmt.Fprintln(c.App.UserErr, err.Error())
+			return cli.ExitStatusUnknownError, err
+		}
+
+		fmt.Fprintln(c.App.UserErr, fmt.Sprintf("%d files, %.1f MB", files, float64(size)/1024/1024))
+		return cli.ExitStatusSuccess, nil
+	},
+}
@@ -0,0 +1,128 @@
+package main
+
+import (
+	"errors"
+	"fmt"
+	"strconv"
+	"strings"
+	"sync"
+
+	"github.com/buildpack/forge"
+	"github.com/fatih/color"
+	"github.com/heroku/tatara/fs"
+	"github.com/heroku/tatara/heroku"
+	"github.com/heroku/tatara/ui"
+)
+
+var dynoColors = []func(string, ...interface{}) string{
+	color.CyanString, color.YellowString, color.GreenString,
+	color.MagentaString, color.BlueString, color.RedString,
+}
+
+type dyno struct {
+	Name string
+	Port int
+	Web  bool
+}
+
+// formationDynos assigns each dyno in the formation a name and a port, using
+// the same port numbering as foreman: basePort + 100 per process type. A
+// formation without any dynos is an error.
+func formationDynos(procfile heroku.Procfile, formation heroku.Formation, basePort int) ([]dyno, error) {
+	var dynos []dyno
+	for i, entry := range formation {
+		if _, ok := procfile.Command(entry.Type); !ok {
+			return nil, fmt.Errorf("process type %s is not declared in the Procfile (available: %s)",
+				entry.Type, strings.Join(procfile.ProcessTypes(), ", "))
+		}
+		for n := 1; n <= entry.Quantity; n++ {
+			dynos = append(dynos, dyno{
+				Name: fmt.Sprintf("%s.%d", entry.Type, n),
+				Port: basePort + i*100 + n - 1,
+				Web:  entry.Type == "web",
+			})
+		}
+	}
+	if len(dynos) == 0 {
+		return nil, errors.New("the formation has no dynos to run")
+	}
+	return dynos, nil
+}
+
+// runFormation runs every dyno concurrently, writing their output to one
+// interleaved stream. All dynos are stopped as soon as one of them exits.
+func runFormation(exit <-chan struct{}, sysFS *fs.FS, slugPath string, dynos []dyno, config forge.RunConfig, manager *dynoManager) error {
+	nameWidth := 0
+	for _, d := range dynos {
+		if len(d.Name) > nameWidth {
+			nameWidth = len(d.Name)
+		}
+	}
+
+	stop := make(chan struct{})
+	var stopOnce sync.Once
+	stopAll := func() { stopOnce.Do(func() { close(stop) }) }
+	go func() {
+		select {
+		case <-exit:
+			stopAll()
+		case <-stop:
+		}
+	}()
+
+	var (
+		wg       sync.WaitGroup
+		logLock  sync.Mutex
+		errLock  sync.Mutex
+		firstErr error
+	)
+	for i, d := range dynos {
+		env := map[string]string{}
+		for name, value := range config.AppConfig.RunningEnv {
+			env[name] = value
+		}
+		env["DYNO"] = d.Name
+		env["PORT"] = strconv.Itoa(d.Port)
+
+		app := *config.AppConfig
+		app.RunningEnv = env
+
+		netConfig := &forge.NetworkConfig{
+			ContainerID:   config.NetworkConfig.ContainerID,
+			HostIP:        config.NetworkConfig.HostIP,
+			ContainerPort: strconv.Itoa(d.Port),
+		}
+		if d.Web && netConfig.ContainerID == "" {
+			netConfig.HostPort = strconv.Itoa(d.Port)
+		}
+
+		dynoConfig := config
+		dynoConfig.AppConfig = &app
+		dynoConfig.NetworkConfig = netConfig
+
+		logs := &ui.PrefixWriter{
+			Out:    color.Output,
+			Prefix: dynoColors[i%len(dynoColors)]("%-*s | ", nameWidth, d.Name),
+			Lock:   &logLock,
+		}
+
+		wg.Add(1)
+		go func(name string) {
+			defer wg.Done()
+			defer stopAll()
+			defer logs.Flush()
+
+			_, err := runSlug(stop, sysFS, slugPath, logs, dynoConfig, manager)
+			if err != nil {
+				errLock.Lock()
+				if firstErr == nil {
+					firstErr = fmt.Errorf("%s: %s", name, err)
+				}
+				errLock.Unlock()
+			}
+		}(d.Name)
+	}
+	wg.Wait()
+
+	return firstErr
+}
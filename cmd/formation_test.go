@@ -0,0 +1,41 @@
+package main
+
+import (
+	"testing"
+
+	"github.com/heroku/tatara/heroku"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestFormationDynos(t *testing.T) {
+	procfile := heroku.Procfile{
+		{Type: "release", Command: "rake db:migrate"},
+		{Type: "web", Command: "puma"},
+		{Type: "worker", Command: "sidekiq"},
+	}
+
+	dynos, err := formationDynos(procfile, heroku.Formation{{Type: "web", Quantity: 2}, {Type: "worker", Quantity: 1}}, 5000)
+	assert.Nil(t, err)
+	assert.Equal(t, []dyno{
+		{Name: "web.1", Port: 5000, Web: true},
+		{Name: "web.2", Port: 5001, Web: true},
+		{Name: "worker.1", Port: 5100},
+	}, dynos)
+
+	dynos, err = formationDynos(procfile, procfile.DefaultFormation(), 5000)
+	assert.Nil(t, err)
+	assert.Equal(t, []dyno{
+		{Name: "web.1", Port: 5000, Web: true},
+		{Name: "worker.1", Port: 5100},
+	}, dynos)
+
+	_, err = formationDynos(procfile, heroku.Formation{{Type: "clock", Quantity: 1}}, 5000)
+	assert.EqualError(t, err, "process type clock is not declared in the Procfile (available: release, web, worker)")
+
+	_, err = formationDynos(procfile, heroku.Formation{{Type: "web", Quantity: 0}}, 5000)
+	assert.EqualError(t, err, "the formation has no dynos to run")
+
+	releaseOnly := heroku.Procfile{{Type: "release", Command: "rake db:migrate"}}
+	_, err = formationDynos(releaseOnly, releaseOnly.DefaultFormation(), 5000)
+	assert.EqualError(t, err, "the formation has no dynos to run")
+}
@@ -0,0 +1,385 @@
+package main
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"os"
+	"path/filepath"
+	"strings"
+	"time"
+
+	"github.com/docker/docker/api/types"
+	"github.com/docker/docker/api/types/filters"
+	dockerClient "github.com/docker/docker/client"
+	"github.com/heroku/tatara/cli"
+	"github.com/heroku/tatara/heroku"
+)
+
+const (
+	// labelTatara marks the images, containers, networks and volumes tatara
+	// creates
+	labelTatara = "io.heroku.tatara"
+	// labelApp records the app a docker object was created for
+	labelApp = "io.heroku.tatara.app"
+)
+
+// tataraLabels returns the labels for a docker object created for an app.
+// Objects shared by apps are created without an app name, so that cleaning
+// up one app leaves them for the others.
+func tataraLabels(appName string) map[string]string {
+	labels := map[string]string{labelTatara: "true"}
+	if appName != "" {
+		labels[labelApp] = appName
+	}
+	return labels
+}
+
+var gcFlags = []cli.Flag{
+	cli.BoolFlag{
+		Name:  "dry-run",
+		Usage: "List what would be removed without removing it",
+	},
+	cli.StringFlag{
+		Name:  "older-than",
+		Usage: "Only remove what was created at least this long ago, like 72h",
+	},
+	cli.BoolFlag{
+		Name:  "all",
+		Usage: "Also remove slugs and the images their slug manifests use",
+	},
+}
+
+var cmdGC = cli.Command{
+	Name: "gc",
+
+	Flags: gcFlags,
+
+	Run: func(c *cli.Context) (int, error) {
+		if len(c.Args) != 0 {
+			fmt.Fprintln(c.App.UserErr, "no arguments expected, use `tatara clean <app name>` to clean up a single app")
+			return cli.ExitStatusInvalidArgs, errors.New("invalid arguments")
+		}
+		return collectGarbage(c, "")
+	},
+}
+
+var cmdClean = cli.Command{
+	Name: "clean",
+
+	Flags: gcFlags,
+
+	Run: func(c *cli.Context) (int, error) {
+		if len(c.Args) != 1 {
+			fmt.Fprintln(c.App.UserErr, "required arguments: <app name>")
+			return cli.ExitStatusInvalidArgs, errors.New("invalid arguments")
+		}
+		return collectGarbage(c, filepath.Clean(c.Args[0]))
+	},
+}
+
+// garbage is something tatara left behind
+type garbage struct {
+	Kind    string
+	Name    string
+	Created time.Time
+	Size    int64
+
+	remove func() error
+}
+
+// collectGarbage lists and removes the images, containers, networks and
+// slug files tatara created, for every app or for a single app. Running
+// containers are never removed. Slugs in the working directory, and the
+// images they use, are only removed when cleaning up their app, when an age
+// is given or with --all. The volumes that keep add-on data are only removed
+// when cleaning up their app without an age.
+func collectGarbage(c *cli.Context, appName string) (int, error) {
+	all := c.Flags.Bool("all")
+	before := time.Now()
+	var slugsBefore time.Time
+	if appName != "" || all {
+		slugsBefore = before
+	}
+	if value := c.Flags.String("older-than"); value != "" {
+		age, err := time.ParseDuration(value)
+		if err != nil {
+			err = fmt.Errorf("invalid age %q, expected a duration like 72h", value)
+			fmt.Fprintln(c.App.UserErr, err.Error())
+			return cli.ExitStatusInvalidArgs, err
+		}
+		before = before.Add(-age)
+		slugsBefore = before
+	}
+
+	files, inUse, err := findSlugFiles(appName, slugsBefore)
+	if err != nil {
+		fmt.Fprintln(c.App.UserErr, err.Error())
+		return cli.ExitStatusUnknownError, err
+	}
+	if all {
+		inUse = nil
+	}
+
+	client, err := dockerClient.NewEnvClient()
+	if err != nil {
+		return cli.ExitStatusUnknownError, err
+	}
+	found, err := findDockerGarbage(client, appName, before, inUse)
+	if err != nil {
+		fmt.Fprintln(c.App.UserErr, err.Error())
+		return cli.ExitStatusUnknownError, err
+	}
+	// add-on data is only removed when cleaning up its app
+	if appName != "" && c.Flags.String("older-than") == "" {
+		found = append(found, findAddonVolumes(client, appName)...)
+	}
+	found = append(found, files...)
+
+	if len(found) == 0 {
+		fmt.Fprintln(c.App.UserErr, "Nothing to remove")
+		return cli.ExitStatusSuccess, nil
+	}
+
+	dryRun := c.Flags.Bool("dry-run")
+	failed := 0
+	var size int64
+	for _, g := range found {
+		description := fmt.Sprintf("%s %s", g.Kind, g.Name)
+		if !g.Created.IsZero() {
+			description += fmt.Sprintf(" (created %s)", g.Created.Format(time.RFC3339))
+		}
+		if dryRun {
+			fmt.Fprintln(c.App.UserOut, fmt.Sprintf("Would remove %s", description))
+			size += g.Size
+			continue
+		}
+		if err := g.remove(); err != nil {
+			fmt.Fprintln(c.App.UserErr, fmt.Sprintf("Could not remove %s: %s", description, err))
+			failed++
+			continue
+		}
+		fmt.Fprintln(c.App.UserOut, fmt.Sprintf("Removed %s", description))
+		size += g.Size
+	}
+
+	if dryRun {
+		fmt.Fprintln(c.App.UserErr, fmt.Sprintf("%d to remove, %.1f MB", len(found), float64(size)/1024/1024))
+		return cli.ExitStatusSuccess, nil
+	}
+	fmt.Fprintln(c.App.UserErr, fmt.Sprintf("%d removed, %.1f MB", len(found)-failed, float64(size)/1024/1024))
+	if failed > 0 {
+		return cli.ExitStatusUnknownError, fmt.Errorf("could not remove %d of %d", failed, len(found))
+	}
+	return cli.ExitStatusSuccess, nil
+}
+
+// findDockerGarbage finds the labelled containers, networks and images
+// created before the given time, leaving out running containers and the
+// images in use. They are returned in the order they can be removed in,
+// since images and networks can't be removed while containers use them.
+func findDockerGarbage(client *dockerClient.Client, appName string, before time.Time, inUse map[string]bool) ([]garbage, error) {
+	ctx := context.Background()
+	args := filters.NewArgs()
+	args.Add("label", labelTatara)
+	if appName != "" {
+		args.Add("label", fmt.Sprintf("%s=%s", labelApp, appName))
+	}
+
+	var found []garbage
+
+	containers, err := client.ContainerList(ctx, types.ContainerListOptions{All: true, Filters: args})
+	if err != nil {
+		return nil, fmt.Errorf("could not list containers: %s", err)
+	}
+	for _, container := range containers {
+		created := time.Unix(container.Created, 0)
+		if created.After(before) || container.State == "running" {
+			continue
+		}
+		id := container.ID
+		name := shortID(id)
+		if len(container.Names) > 0 {
+			name = container.Names[0]
+		}
+		found = append(found, garbage{
+			Kind:    "container",
+			Name:    name,
+			Created: created,
+			remove: func() error {
+				return client.ContainerRemove(ctx, id, types.ContainerRemoveOptions{RemoveVolumes: true})
+			},
+		})
+	}
+
+	networks, err := client.NetworkList(ctx, types.NetworkListOptions{Filters: args})
+	if err != nil {
+		return nil, fmt.Errorf("could not list networks: %s", err)
+	}
+	for _, network := range networks {
+		if network.Created.After(before) {
+			continue
+		}
+		id := network.ID
+		found = append(found, garbage{
+			Kind:    "network",
+			Name:    network.Name,
+			Created: network.Created,
+			remove: func() error {
+				return client.NetworkRemove(ctx, id)
+			},
+		})
+	}
+
+	images, err := client.ImageList(ctx, types.ImageListOptions{Filters: args})
+	if err != nil {
+		return nil, fmt.Errorf("could not list images: %s", err)
+	}
+	for _, image := range images {
+		created := time.Unix(image.Created, 0)
+		if created.After(before) || imageInUse(image, inUse) {
+			continue
+		}
+		id := image.ID
+		name := shortID(id)
+		if len(image.RepoTags) > 0 && image.RepoTags[0] != "<none>:<none>" {
+			name = image.RepoTags[0]
+		}
+		found = append(found, garbage{
+			Kind:    "image",
+			Name:    name,
+			Created: created,
+			Size:    image.Size,
+			remove: func() error {
+				// images from older heroku.yml revisions can share layers
+				// with newer ones, which docker keeps
+				_, err := client.ImageRemove(ctx, id, types.ImageRemoveOptions{Force: true, PruneChildren: true})
+				return err
+			},
+		})
+	}
+
+	return found, nil
+}
+
+// findAddonVolumes finds the volumes that keep the add-on data of an app,
+// from the add-ons of the app its slug was built from
+func findAddonVolumes(client *dockerClient.Client, appName string) []garbage {
+	manifest, err := heroku.ReadSlugManifest(fmt.Sprintf("%s.slug", appName))
+	if err != nil {
+		return nil
+	}
+	herokuConfig, err := readHerokuConfig(manifest.AppDir)
+	if err != nil {
+		return nil
+	}
+	appJSON, err := readAppJSON(manifest.AppDir)
+	if err != nil {
+		return nil
+	}
+
+	ctx := context.Background()
+	var found []garbage
+	for _, addon := range appAddons(herokuConfig, appJSON) {
+		service, err := addon.LocalService()
+		if err != nil || service.DataDir == "" {
+			continue
+		}
+		name := addonVolume(appName, addon)
+		if _, err := client.VolumeInspect(ctx, name); err != nil {
+			continue
+		}
+		found = append(found, garbage{
+			Kind: "volume",
+			Name: name,
+			remove: func() error {
+				return client.VolumeRemove(ctx, name, false)
+			},
+		})
+	}
+	return found
+}
+
+// imageInUse reports whether an image is one of the given images, by ID,
+// tag or repo digest
+func imageInUse(image types.ImageSummary, inUse map[string]bool) bool {
+	if inUse[image.ID] {
+		return true
+	}
+	for _, ref := range append(image.RepoTags, image.RepoDigests...) {
+		if inUse[ref] {
+			return true
+		}
+	}
+	return false
+}
+
+// findSlugFiles finds the slugs in the working directory that were built
+// before the given time, with their manifests and caches. Only slugs that
+// have a slug manifest describing them are found, since tatara writes one
+// next to every slug. It also returns the images used by the slugs that are
+// kept.
+func findSlugFiles(appName string, before time.Time) ([]garbage, map[string]bool, error) {
+	manifestPaths, err := filepath.Glob(heroku.SlugManifestPath("*.slug"))
+	if err != nil {
+		return nil, nil, err
+	}
+
+	var found []garbage
+	inUse := map[string]bool{}
+	for _, manifestPath := range manifestPaths {
+		slugPath := strings.TrimSuffix(manifestPath, ".json")
+		manifest, err := heroku.ReadSlugManifest(slugPath)
+		if err != nil {
+			continue
+		}
+		slugInfo, err := os.Lstat(slugPath)
+		if err != nil || !slugInfo.Mode().IsRegular() || slugInfo.Size() != manifest.Size {
+			continue
+		}
+
+		name := strings.TrimSuffix(slugPath, ".slug")
+		if (appName != "" && name != appName) || !manifest.CreatedAt.Before(before) {
+			for _, image := range []string{
+				manifest.Stack.BuildImage,
+				manifest.Stack.BuildImageDigest,
+				manifest.Stack.RunImage,
+				manifest.Stack.RunImageDigest,
+			} {
+				if image != "" {
+					inUse[image] = true
+				}
+			}
+			continue
+		}
+
+		for _, path := range []string{slugPath, manifestPath, fmt.Sprintf(".%s.cache", name)} {
+			info, err := os.Lstat(path)
+			if err != nil || !info.Mode().IsRegular() {
+				continue
+			}
+			path := path
+			found = append(found, garbage{
+				Kind:    "file",
+				Name:    path,
+				Created: manifest.CreatedAt,
+				Size:    info.Size(),
+				remove: func() error {
+					return os.Remove(path)
+				},
+			})
+		}
+	}
+	return found, inUse, nil
+}
+
+// shortID shortens a docker ID like sha256:<hex> to 12 hex characters
+func shortID(id string) string {
+	if i := len("sha256:"); len(id) > i && id[:i] == "sha256:" {
+		id = id[i:]
+	}
+	if len(id) > 12 {
+		id = id[:12]
+	}
+	return id
+}
@@ -0,0 +1,85 @@
+package main
+
+import (
+	"io/ioutil"
+	"os"
+	"sort"
+	"testing"
+	"time"
+
+	"github.com/heroku/tatara/heroku"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestFindSlugFiles(t *testing.T) {
+	dir, err := ioutil.TempDir("", "slugs")
+	assert.Nil(t, err)
+	defer os.RemoveAll(dir)
+	wd, err := os.Getwd()
+	assert.Nil(t, err)
+	defer os.Chdir(wd)
+	assert.Nil(t, os.Chdir(dir))
+
+	built := time.Date(2018, 1, 1, 0, 0, 0, 0, time.UTC)
+	writeSlug := func(name string, createdAt time.Time, runImage string) {
+		slugPath := name + ".slug"
+		assert.Nil(t, ioutil.WriteFile(slugPath, []byte("slug of "+name), 0644))
+		assert.Nil(t, ioutil.WriteFile("."+name+".cache", []byte("cache"), 0644))
+		assert.Nil(t, heroku.WriteSlugManifest(slugPath, heroku.SlugManifest{
+			Size:      int64(len("slug of " + name)),
+			CreatedAt: createdAt,
+			Stack:     heroku.SlugStack{RunImage: runImage, BuildImage: "heroku/heroku:18-build"},
+		}))
+	}
+	writeSlug("old", built, "abc:run")
+	writeSlug("new", built.Add(48*time.Hour), "def:run")
+
+	// files that only look like tatara's are kept
+	assert.Nil(t, ioutil.WriteFile("notes.slug", []byte("not a slug"), 0644))
+	assert.Nil(t, ioutil.WriteFile(".other.cache", []byte("not a cache"), 0644))
+	assert.Nil(t, ioutil.WriteFile("broken.slug", []byte("slug"), 0644))
+	assert.Nil(t, ioutil.WriteFile("broken.slug.json", []byte("{"), 0644))
+	assert.Nil(t, ioutil.WriteFile("changed.slug", []byte("a different slug"), 0644))
+	assert.Nil(t, heroku.WriteSlugManifest("changed.slug", heroku.SlugManifest{Size: 1, CreatedAt: built}))
+
+	names := func(found []garbage) []string {
+		var names []string
+		for _, g := range found {
+			names = append(names, g.Name)
+		}
+		sort.Strings(names)
+		return names
+	}
+
+	found, inUse, err := findSlugFiles("", time.Time{})
+	assert.Nil(t, err)
+	assert.Empty(t, found)
+	assert.Equal(t, map[string]bool{
+		"abc:run":                true,
+		"def:run":                true,
+		"heroku/heroku:18-build": true,
+	}, inUse)
+
+	found, inUse, err = findSlugFiles("", built.Add(24*time.Hour))
+	assert.Nil(t, err)
+	assert.Equal(t, []string{".old.cache", "old.slug", "old.slug.json"}, names(found))
+	assert.Equal(t, map[string]bool{"def:run": true, "heroku/heroku:18-build": true}, inUse)
+
+	found, inUse, err = findSlugFiles("new", time.Now())
+	assert.Nil(t, err)
+	assert.Equal(t, []string{".new.cache", "new.slug", "new.slug.json"}, names(found))
+	assert.Equal(t, map[string]bool{"abc:run": true, "heroku/heroku:18-build": true}, inUse)
+
+	for _, g := range found {
+		assert.Nil(t, g.remove())
+	}
+	_, err = os.Stat("new.slug")
+	assert.True(t, os.IsNotExist(err))
+	_, err = os.Stat("notes.slug")
+	assert.Nil(t, err)
+}
+
+func TestTataraLabels(t *testing.T) {
+	assert.Equal(t, map[string]string{labelTatara: "true", labelApp: "myapp"}, tataraLabels("myapp"))
+	assert.Equal(t, map[string]string{labelTatara: "true"}, tataraLabels(""))
+}
@@ -0,0 +1,121 @@
+package main
+
+import (
+	"context"
+	"fmt"
+	"os"
+	"strings"
+
+	"github.com/buildpack/forge/engine"
+	dockerClient "github.com/docker/docker/client"
+	"github.com/heroku/tatara/heroku"
+)
+
+// readSlugManifest reads the manifest that `tatara build` wrote next to a slug
+func readSlugManifest(slugPath string) (heroku.SlugManifest, error) {
+	manifest, err := heroku.ReadSlugManifest(slugPath)
+	if os.IsNotExist(err) {
+		return manifest, fmt.Errorf("no slug manifest found at %s, rebuild the slug with `tatara build`", heroku.SlugManifestPath(slugPath))
+	} else if err != nil {
+		return manifest, err
+	}
+	if manifest.Stack.RunImage == "" {
+		return manifest, fmt.Errorf("slug manifest %s does not record a run image, rebuild the slug with `tatara build`", heroku.SlugManifestPath(slugPath))
+	}
+	return manifest, nil
+}
+
+// lookupStack finds a stack in the built in stacks and the stacks file
+func lookupStack(name string) (heroku.Stack, error) {
+	stacks, err := heroku.LoadStacks(heroku.DefaultStacksFile())
+	if err != nil {
+		return heroku.Stack{}, err
+	}
+	return stacks.Lookup(name)
+}
+
+// slugRunImage returns the run image recorded for a slug and whether it only
+// exists locally, unless a stack name or an image is given with --stack
+func slugRunImage(manifest heroku.SlugManifest, stackFlag string) (string, bool) {
+	if stackFlag != "" {
+		if stack, err := lookupStack(stackFlag); err == nil {
+			return stack.RunImage, false
+		}
+		return stackFlag, false
+	}
+	return manifest.Stack.RunImage, manifest.Stack.RunImageLocal
+}
+
+// prepareRunImage pulls the run image a slug was built for according to the
+// pull policy. Run images built from heroku.yml only exist locally, so they
+// are checked for instead.
+func prepareRunImage(image string, local bool, policy pullPolicy, pull func(string) <-chan engine.Progress) error {
+	if local {
+		if !imageExists(image) {
+			return fmt.Errorf("run image %s was not found, rebuild the slug with `tatara build`", image)
+		}
+		return nil
+	}
+	return pullImages("Downloading Runtime Image", policy, pull, pullImage{Name: "run", Ref: image})
+}
+
+func imageExists(image string) bool {
+	client, err := dockerClient.NewEnvClient()
+	if err != nil {
+		return false
+	}
+	_, _, err = client.ImageInspectWithRaw(context.Background(), image)
+	return err == nil
+}
+
+// repoDigest returns the repo@sha256 digest a local image was pulled by, or
+// an empty string for images that were only built locally
+func repoDigest(image string) string {
+	client, err := dockerClient.NewEnvClient()
+	if err != nil {
+		return ""
+	}
+	info, _, err := client.ImageInspectWithRaw(context.Background(), image)
+	if err != nil {
+		return ""
+	}
+	repo := image
+	if i := strings.LastIndex(repo, ":"); i > strings.LastIndex(repo, "/") {
+		repo = repo[:i]
+	}
+	for _, digest := range info.RepoDigests {
+		if strings.HasPrefix(digest, repo+"@") {
+			return digest
+		}
+	}
+	return ""
+}
+
+// pinStack returns the stack images pinned in the lockfile, pulling them
+// according to the pull policy. Unpinned stacks are pulled by tag and pinned
+// to the digests of the local images.
+func pinStack(stack heroku.Stack, lock *heroku.Lockfile, policy pullPolicy, pull func(string) <-chan engine.Progress) (*heroku.LockedStack, error) {
+	pinned, ok := lock.PinnedStack(stack)
+	if !ok {
+		pinned = &heroku.LockedStack{
+			Name:       stack.Name,
+			BuildImage: stack.BuildImage,
+			RunImage:   stack.RunImage,
+		}
+	}
+
+	err := pullImages("Downloading Stack Images", policy, pull,
+		pullImage{Name: "build", Ref: pinned.BuildRef()},
+		pullImage{Name: "run", Ref: pinned.RunRef()},
+	)
+	if err != nil {
+		return nil, err
+	}
+
+	if !ok {
+		pinned.BuildImageDigest = repoDigest(stack.BuildImage)
+		pinned.RunImageDigest = repoDigest(stack.RunImage)
+		lock.Stack = pinned
+	}
+	return pinned, nil
+}
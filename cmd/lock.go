@@ -0,0 +1,145 @@
+package main
+
+import (
+	"errors"
+	"fmt"
+	"path/filepath"
+
+	"github.com/buildpack/forge/engine"
+	"github.com/buildpack/forge/engine/docker"
+	"github.com/heroku/tatara/buildpack"
+	"github.com/heroku/tatara/cli"
+	"github.com/heroku/tatara/heroku"
+)
+
+var cmdLock = cli.Command{
+	Name: "lock",
+
+	Flags: []cli.Flag{
+		cli.BoolFlag{
+			Name:  "update",
+			Usage: "Pull the stack images and fetch the buildpacks again, and pin what they resolve to now",
+		},
+		cli.StringSliceFlag{
+			Name:  "buildpack",
+			Usage: "A buildpack to use on this app",
+		},
+		cli.StringFlag{
+			Name:  "buildpack-registry",
+			Usage: "The base URL of the buildpack registry",
+		},
+		cli.StringFlag{
+			Name:  "stack",
+			Usage: "The name of the stack to build on, from the stack catalog",
+		},
+	},
+
+	Run: func(c *cli.Context) (int, error) {
+		if len(c.Args) != 1 {
+			fmt.Fprintln(c.App.UserErr, "required arguments: <app directory>")
+			return cli.ExitStatusInvalidArgs, errors.New("invalid arguments")
+		}
+
+		appDir := filepath.Clean(c.Args[0])
+		update := c.Flags.Bool("update")
+
+		appJSON, err := readAppJSON(appDir)
+		if err != nil {
+			fmt.Fprintln(c.App.UserErr, err.Error())
+			return cli.ExitStatusInvalidArgs, err
+		}
+		herokuConfig, err := readHerokuConfig(appDir)
+		if err != nil {
+			fmt.Fprintln(c.App.UserErr, err.Error())
+			return cli.ExitStatusInvalidArgs, err
+		}
+
+		stackName := c.Flags.String("stack")
+		if stackName == "" {
+			stackName = appJSON.Stack
+		}
+		if stackName == "" {
+			stackName = HerokuStack
+		}
+		stack, err := lookupStack(stackName)
+		if err != nil {
+			fmt.Fprintln(c.App.UserErr, err.Error())
+			return cli.ExitStatusInvalidArgs, err
+		}
+
+		lock, err := heroku.ReadLockfile(appDir)
+		if err != nil {
+			fmt.Fprintln(c.App.UserErr, err.Error())
+			return cli.ExitStatusInvalidArgs, err
+		}
+		if update {
+			lock.Stack = nil
+		}
+
+		engine, err := docker.New(&engine.EngineConfig{
+			Exit: c.Exit,
+		})
+		if err != nil {
+			return cli.ExitStatusUnknownError, err
+		}
+		defer engine.Close()
+
+		pull := pullMissing
+		if update {
+			pull = pullAlways
+		}
+		pinned, err := pinStack(stack, lock, pull, engine.NewImage().Pull)
+		if err != nil {
+			return cli.ExitStatusUnknownError, err
+		}
+
+		registry := buildpack.RegistryURL(c.Flags.String("buildpack-registry"), herokuConfig.Build.Registry)
+		buildpacks, err := appBuildpacks(c.Flags.StringSlice("buildpack"), registry, herokuConfig, appJSON)
+		if err != nil {
+			fmt.Fprintln(c.App.UserErr, err.Error())
+			return cli.ExitStatusInvalidArgs, err
+		}
+
+		// only an update moves git buildpacks on from their locked commits
+		cache := &buildpack.Cache{Dir: buildpack.DefaultCacheDir(), Update: update}
+		pins := &lock.Lockfile
+		if update {
+			pins = nil
+		}
+		locked := &buildpack.Lockfile{}
+		for _, bp := range buildpacks {
+			_, _, lockEntry, err := fetchBuildpack(bp, cache, pins)
+			if err != nil {
+				return cli.ExitStatusUnknownError, err
+			}
+			if lockEntry == nil {
+				continue
+			}
+			if !update {
+				if err := lock.Verify(*lockEntry); err != nil {
+					fmt.Fprintln(c.App.UserErr, err.Error())
+					return cli.ExitStatusUnknownError, err
+				}
+			}
+			locked.Lock(*lockEntry)
+		}
+		lock.Lockfile = *locked
+
+		if err := lock.Write(appDir); err != nil {
+			return cli.ExitStatusUnknownError, err
+		}
+
+		fmt.Fprintln(c.App.UserOut, fmt.Sprintf("Stack %s", pinned.Name))
+		fmt.Fprintln(c.App.UserOut, fmt.Sprintf("  build image: %s", pinned.BuildRef()))
+		fmt.Fprintln(c.App.UserOut, fmt.Sprintf("  run image:   %s", pinned.RunRef()))
+		for _, locked := range lock.Buildpacks {
+			pin := locked.Commit
+			if locked.SHA256 != "" {
+				pin = "sha256:" + locked.SHA256
+			}
+			fmt.Fprintln(c.App.UserOut, fmt.Sprintf("Buildpack %s (%s)", locked.URL, pin))
+		}
+		fmt.Fprintln(c.App.UserErr, fmt.Sprintf("Wrote %s", heroku.LockfilePath(appDir)))
+		return cli.ExitStatusSuccess, nil
+	},
+}
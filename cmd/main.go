@@ -23,6 +23,10 @@ func runApp() int {
 	go func() {
 		<-signalChan
 		close(exitChan)
+
+		// dynos get a grace period to shut down, a second signal skips it
+		<-signalChan
+		os.Exit(cli.ExitStatusUnknownError)
 	}()
 
 	if os.Getenv("CPU_PROFILE") != "" {
@@ -44,6 +48,13 @@ func runApp() int {
 			cmdBuild,
 			cmdRun,
 			cmdExport,
+			cmdRelease,
+			cmdPostdeploy,
+			cmdFiles,
+			cmdLock,
+			cmdGC,
+			cmdClean,
+			cmdValidate,
 		},
 
 		Flags: []cli.Flag{
@@ -0,0 +1,113 @@
+package main
+
+import (
+	"errors"
+	"fmt"
+	"os"
+	"path/filepath"
+
+	"github.com/buildpack/forge/engine"
+	"github.com/buildpack/forge/engine/docker"
+	"github.com/heroku/tatara/cli"
+	"github.com/heroku/tatara/fs"
+)
+
+var cmdPostdeploy = cli.Command{
+	Name: "postdeploy",
+
+	Flags: []cli.Flag{
+		cli.StringFlag{
+			Name:  "stack",
+			Usage: "The stack or run image to use (defaults to the run image of the build)",
+		},
+		pullFlag,
+		skipStackPullFlag,
+		cli.StringSliceFlag{
+			Name:  "env",
+			Usage: "A single environment variable",
+		},
+		envFileFlag,
+		cli.BoolFlag{
+			Name:  "debug",
+			Usage: "Enable debug logging",
+		},
+	},
+
+	Run: func(c *cli.Context) (int, error) {
+		if len(c.Args) != 1 {
+			fmt.Fprintln(c.App.UserErr, "required arguments: <app name>")
+			return cli.ExitStatusInvalidArgs, errors.New("invalid arguments")
+		}
+
+		appName := filepath.Clean(c.Args[0])
+		debug := c.Flags.Bool("debug")
+
+		sysFS := &fs.FS{}
+		slugPath := fmt.Sprintf("./%s.slug", appName)
+		if _, err := os.Stat(slugPath); err != nil {
+			return cli.ExitStatusInvalidArgs, err
+		}
+
+		manifest, err := readSlugManifest(slugPath)
+		if err != nil {
+			fmt.Fprintln(c.App.UserErr, err.Error())
+			return cli.ExitStatusInvalidArgs, err
+		}
+		appJSON, err := readAppJSON(manifest.AppDir)
+		if err != nil {
+			fmt.Fprintln(c.App.UserErr, err.Error())
+			return cli.ExitStatusInvalidArgs, err
+		}
+		command := appJSON.Scripts.Postdeploy
+		if command == "" {
+			fmt.Fprintln(c.App.UserErr, "app.json has no postdeploy script")
+			return cli.ExitStatusInvalidArgs, errors.New("no postdeploy script")
+		}
+		envVars, err := loadEnvVars(c, manifest.AppDir)
+		if err != nil {
+			fmt.Fprintln(c.App.UserErr, err.Error())
+			return cli.ExitStatusInvalidArgs, err
+		}
+
+		stack, localStack := slugRunImage(manifest, c.Flags.String("stack"))
+		if debug {
+			fmt.Println(fmt.Sprintf("Using image: %s", stack))
+		}
+
+		engine, err := docker.New(&engine.EngineConfig{
+			Exit: c.Exit,
+		})
+		if err != nil {
+			return cli.ExitStatusUnknownError, err
+		}
+		defer engine.Close()
+
+		pull, err := readPullPolicy(c)
+		if err != nil {
+			fmt.Fprintln(c.App.UserErr, err.Error())
+			return cli.ExitStatusInvalidArgs, err
+		}
+		err = prepareRunImage(stack, localStack, pull, engine.NewImage().Pull)
+		if err != nil {
+			fmt.Fprintln(c.App.UserErr, err.Error())
+			return cli.ExitStatusUnknownError, err
+		}
+
+		status, err := runOneOffProcess(c, sysFS, slugPath, "postdeploy", command, runtimeOptions{
+			AppName:     appName,
+			AppDir:      manifest.AppDir,
+			Stack:       stack,
+			UserEnvVars: envVars,
+			Pull:        pull,
+			PullImage:   engine.NewImage().Pull,
+		})
+		if err != nil {
+			return cli.ExitStatusUnknownError, err
+		}
+		if status != 0 {
+			fmt.Fprintln(c.App.UserErr, fmt.Sprintf("Postdeploy script failed with status %d", status))
+			return int(status), fmt.Errorf("postdeploy script exited with status %d", status)
+		}
+		return cli.ExitStatusSuccess, nil
+	},
+}
@@ -0,0 +1,144 @@
+package main
+
+import (
+	"fmt"
+	"strings"
+	"sync"
+
+	"github.com/buildpack/forge/engine"
+	"github.com/heroku/tatara/cli"
+	"github.com/heroku/tatara/ui"
+)
+
+// pullPolicy decides when images are pulled from their registry
+type pullPolicy string
+
+const (
+	// pullAlways pulls images even if they exist locally
+	pullAlways pullPolicy = "always"
+	// pullMissing pulls only the images that don't exist locally
+	pullMissing pullPolicy = "missing"
+	// pullNever uses local images only
+	pullNever pullPolicy = "never"
+)
+
+var pullFlag = cli.StringFlag{
+	Name:  "pull",
+	Usage: "When to pull the stack images: always, missing or never (defaults to missing)",
+}
+
+var skipStackPullFlag = cli.BoolFlag{
+	Name:  "skip-stack-pull",
+	Usage: "Use a local stack image only (deprecated, use --pull=never)",
+}
+
+// readPullPolicy returns the pull policy given with --pull, falling back to
+// --skip-stack-pull
+func readPullPolicy(c *cli.Context) (pullPolicy, error) {
+	switch policy := pullPolicy(c.Flags.String("pull")); policy {
+	case "":
+		if c.Flags.Bool("skip-stack-pull") {
+			return pullNever, nil
+		}
+		return pullMissing, nil
+	case pullAlways, pullMissing, pullNever:
+		return policy, nil
+	default:
+		return "", fmt.Errorf("invalid pull policy %q, expected always, missing or never", policy)
+	}
+}
+
+// pullImage is an image to pull, with the name it is shown under in the
+// progress display
+type pullImage struct {
+	Name string
+	Ref  string
+}
+
+// pullImages makes the images available locally according to the pull
+// policy. The images that need pulling are pulled concurrently, with a
+// combined progress display.
+func pullImages(message string, policy pullPolicy, pull func(string) <-chan engine.Progress, images ...pullImage) error {
+	var pulls []pullImage
+	seen := map[string]bool{}
+	for _, image := range images {
+		if seen[image.Ref] {
+			continue
+		}
+		seen[image.Ref] = true
+
+		if policy != pullAlways && imageExists(image.Ref) {
+			continue
+		}
+		if policy == pullNever {
+			return fmt.Errorf("image %s was not found locally, pull it or use --pull=missing", image.Ref)
+		}
+		pulls = append(pulls, image)
+	}
+	if len(pulls) == 0 {
+		return nil
+	}
+	return ui.Loading(message, mergePullProgress(pulls, pull))
+}
+
+// mergePullProgress pulls every image at once, combining their progress into
+// a single channel
+func mergePullProgress(images []pullImage, pull func(string) <-chan engine.Progress) <-chan engine.Progress {
+	merged := make(chan engine.Progress)
+	statuses := make([]string, len(images))
+	var mutex sync.Mutex
+	var wg sync.WaitGroup
+	for i, image := range images {
+		wg.Add(1)
+		go func(i int, image pullImage, progress <-chan engine.Progress) {
+			defer wg.Done()
+			for p := range progress {
+				status, err := p.Status()
+				if err != nil {
+					err = fmt.Errorf("could not pull %s: %s", image.Ref, err)
+				}
+
+				// updates are sent while holding the lock, so that they
+				// arrive in order
+				mutex.Lock()
+				statuses[i] = status
+				merged <- pullProgress{
+					images:   images,
+					statuses: append([]string{}, statuses...),
+					err:      err,
+				}
+				mutex.Unlock()
+			}
+		}(i, image, pull(image.Ref))
+	}
+	go func() {
+		wg.Wait()
+		close(merged)
+	}()
+	return merged
+}
+
+type pullProgress struct {
+	images   []pullImage
+	statuses []string
+	err      error
+}
+
+// Status shows the progress of every image that reported it. Pulls without
+// progress show as N/A, which the display shows as a spinner.
+func (p pullProgress) Status() (string, error) {
+	if len(p.images) == 1 {
+		return p.statuses[0], p.err
+	}
+	var parts []string
+	for i, status := range p.statuses {
+		if status == "" || status == "N/A" {
+			continue
+		}
+		parts = append(parts, fmt.Sprintf("%s %s", p.images[i].Name, status))
+	}
+	if len(parts) == 0 {
+		return "N/A", p.err
+	}
+	return strings.Join(parts, ", "), p.err
+}
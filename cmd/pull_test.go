@@ -0,0 +1,63 @@
+package main
+
+import (
+	"errors"
+	"testing"
+
+	"github.com/buildpack/forge/engine"
+	"github.com/stretchr/testify/assert"
+)
+
+type testProgress struct {
+	status string
+	err    error
+}
+
+func (p testProgress) Status() (string, error) {
+	return p.status, p.err
+}
+
+func TestMergePullProgress(t *testing.T) {
+	updates := map[string][]engine.Progress{
+		"heroku/heroku:18": {testProgress{status: "N/A"}, testProgress{status: "50%"}, testProgress{status: "100%"}},
+		"redis:4":          {testProgress{status: "10%"}, testProgress{err: errors.New("not found")}},
+	}
+	pull := func(ref string) <-chan engine.Progress {
+		progress := make(chan engine.Progress, len(updates[ref]))
+		for _, p := range updates[ref] {
+			progress <- p
+		}
+		close(progress)
+		return progress
+	}
+
+	images := []pullImage{{Name: "stack", Ref: "heroku/heroku:18"}, {Name: "redis", Ref: "redis:4"}}
+	var last engine.Progress
+	var errs []error
+	count := 0
+	for p := range mergePullProgress(images, pull) {
+		if _, err := p.Status(); err != nil {
+			errs = append(errs, err)
+		}
+		last = p
+		count++
+	}
+	assert.Equal(t, 5, count)
+	assert.Equal(t, []error{errors.New("could not pull redis:4: not found")}, errs)
+	status, _ := last.Status()
+	assert.Equal(t, "stack 100%", status)
+}
+
+func TestPullProgressStatus(t *testing.T) {
+	images := []pullImage{{Name: "stack", Ref: "heroku/heroku:18"}, {Name: "redis", Ref: "redis:4"}}
+
+	status, err := pullProgress{images: images, statuses: []string{"N/A", ""}}.Status()
+	assert.Nil(t, err)
+	assert.Equal(t, "N/A", status)
+
+	status, _ = pullProgress{images: images, statuses: []string{"50%", "10%"}}.Status()
+	assert.Equal(t, "stack 50%, redis 10%", status)
+
+	status, _ = pullProgress{images: images[:1], statuses: []string{"N/A"}}.Status()
+	assert.Equal(t, "N/A", status)
+}
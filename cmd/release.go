@@ -0,0 +1,236 @@
+package main
+
+import (
+	"errors"
+	"fmt"
+	"os"
+	"path/filepath"
+
+	"github.com/buildpack/forge"
+	"github.com/buildpack/forge/engine"
+	"github.com/buildpack/forge/engine/docker"
+	"github.com/fatih/color"
+	"github.com/heroku/tatara/cli"
+	"github.com/heroku/tatara/fs"
+	"github.com/heroku/tatara/heroku"
+)
+
+var cmdRelease = cli.Command{
+	Name: "release",
+
+	Flags: []cli.Flag{
+		cli.StringFlag{
+			Name:  "stack",
+			Usage: "The stack or run image to use (defaults to the run image of the build)",
+		},
+		pullFlag,
+		skipStackPullFlag,
+		cli.StringSliceFlag{
+			Name:  "env",
+			Usage: "A single environment variable",
+		},
+		envFileFlag,
+		cli.BoolFlag{
+			Name:  "debug",
+			Usage: "Enable debug logging",
+		},
+	},
+
+	Run: func(c *cli.Context) (int, error) {
+		if len(c.Args) != 1 {
+			fmt.Fprintln(c.App.UserErr, "required arguments: <app name>")
+			return cli.ExitStatusInvalidArgs, errors.New("invalid arguments")
+		}
+
+		appName := filepath.Clean(c.Args[0])
+		debug := c.Flags.Bool("debug")
+
+		sysFS := &fs.FS{}
+		slugPath := fmt.Sprintf("./%s.slug", appName)
+		if _, err := os.Stat(slugPath); err != nil {
+			return cli.ExitStatusInvalidArgs, err
+		}
+
+		manifest, err := readSlugManifest(slugPath)
+		if err != nil {
+			fmt.Fprintln(c.App.UserErr, err.Error())
+			return cli.ExitStatusInvalidArgs, err
+		}
+		envVars, err := loadEnvVars(c, manifest.AppDir)
+		if err != nil {
+			fmt.Fprintln(c.App.UserErr, err.Error())
+			return cli.ExitStatusInvalidArgs, err
+		}
+		stack, localStack := slugRunImage(manifest, c.Flags.String("stack"))
+		if debug {
+			fmt.Println(fmt.Sprintf("Using image: %s", stack))
+		}
+
+		engine, err := docker.New(&engine.EngineConfig{
+			Exit: c.Exit,
+		})
+		if err != nil {
+			return cli.ExitStatusUnknownError, err
+		}
+		defer engine.Close()
+
+		pull, err := readPullPolicy(c)
+		if err != nil {
+			fmt.Fprintln(c.App.UserErr, err.Error())
+			return cli.ExitStatusInvalidArgs, err
+		}
+		err = prepareRunImage(stack, localStack, pull, engine.NewImage().Pull)
+		if err != nil {
+			fmt.Fprintln(c.App.UserErr, err.Error())
+			return cli.ExitStatusUnknownError, err
+		}
+
+		return runRelease(c, sysFS, slugPath, runtimeOptions{
+			AppName:     appName,
+			AppDir:      manifest.AppDir,
+			Stack:       stack,
+			UserEnvVars: envVars,
+			Pull:        pull,
+			PullImage:   engine.NewImage().Pull,
+		})
+	},
+}
+
+// runRelease runs the release process from the slug's Procfile, if there is
+// one. A release that exits with a non-zero status fails the command, as
+// does a Procfile that can't be read.
+func runRelease(c *cli.Context, sysFS *fs.FS, slugPath string, options runtimeOptions) (int, error) {
+	procfile, err := heroku.ReadSlugProcfile(slugPath)
+	if err == heroku.ErrNoProcfile {
+		return cli.ExitStatusSuccess, nil
+	} else if err != nil {
+		err = fmt.Errorf("could not read the Procfile of %s: %s", slugPath, err)
+		fmt.Fprintln(c.App.UserErr, err.Error())
+		return cli.ExitStatusUnknownError, err
+	}
+	command, ok := procfile.Command("release")
+	if !ok {
+		return cli.ExitStatusSuccess, nil
+	}
+
+	fmt.Println(fmt.Sprintf("Running release phase for %s...", options.AppName))
+	status, err := runOneOffProcess(c, sysFS, slugPath, "release", command, options)
+	if err != nil {
+		return cli.ExitStatusUnknownError, err
+	}
+	if status != 0 {
+		fmt.Fprintln(c.App.UserErr, fmt.Sprintf("Release phase failed with status %d", status))
+		return int(status), fmt.Errorf("release command exited with status %d", status)
+	}
+	return cli.ExitStatusSuccess, nil
+}
+
+// runOneOffProcess runs a command from the slug in a one-off dyno named after
+// the process type, with the app's add-ons, and returns its exit status
+func runOneOffProcess(c *cli.Context, sysFS *fs.FS, slugPath, processType, command string, options runtimeOptions) (int64, error) {
+	runtime, err := startRuntimeEnv(options, "127.0.0.1", nil)
+	if err != nil {
+		fmt.Fprintln(c.App.UserErr, err.Error())
+		return 0, err
+	}
+	defer runtime.Close()
+
+	dynoName := oneOffDynoName(processType)
+	runtime.ConfigVars["DYNO"] = dynoName
+
+	fmt.Println(fmt.Sprintf("Running %s on %s (%s)...", command, options.AppName, dynoName))
+	return runSlug(c.Exit, sysFS, slugPath, color.Output, forge.RunConfig{
+		Stack: options.Stack,
+		Color: color.GreenString,
+		AppConfig: &forge.AppConfig{
+			Name:       options.AppName,
+			RunningEnv: runtime.ConfigVars,
+			Command:    command,
+		},
+		NetworkConfig: runtime.Network,
+		WorkingDir:    "/app",
+		OutputDir:     "/",
+	}, nil)
+}
+
+// runtimeOptions describe the environment an app runs in
+type runtimeOptions struct {
+	AppName string
+	AppDir  string
+	Stack   string
+	// UserEnvVars are the config vars from the env file and flags
+	UserEnvVars map[string]string
+
+	Pull      pullPolicy
+	PullImage func(string) <-chan engine.Progress
+}
+
+// runtimeEnv holds the config vars an app runs with and the add-ons they
+// point to
+type runtimeEnv struct {
+	ConfigVars map[string]string
+	Network    *forge.NetworkConfig
+
+	addons *addonEnvironment
+}
+
+// startRuntimeEnv starts the add-ons from heroku.yml or app.json and returns
+// the config vars of the app. The env file and flags take precedence over
+// the app.json defaults, which take precedence over the add-ons. The
+// publishPorts map holds the host port to publish for each container port.
+func startRuntimeEnv(options runtimeOptions, hostIP string, publishPorts map[int]int) (*runtimeEnv, error) {
+	herokuConfig, err := readHerokuConfig(options.AppDir)
+	if err != nil {
+		return nil, err
+	}
+	appJSON, err := readAppJSON(options.AppDir)
+	if err != nil {
+		return nil, err
+	}
+
+	env := &runtimeEnv{
+		ConfigVars: appJSON.EnvDefaults(),
+		Network:    &forge.NetworkConfig{HostIP: hostIP},
+	}
+	for name, value := range options.UserEnvVars {
+		env.ConfigVars[name] = value
+	}
+
+	addons := appAddons(herokuConfig, appJSON)
+	if len(addons) == 0 {
+		return env, nil
+	}
+
+	var addonImages []pullImage
+	for _, addon := range addons {
+		service, err := addon.LocalService()
+		if err != nil {
+			return nil, err
+		}
+		addonImages = append(addonImages, pullImage{Name: addon.Service(), Ref: service.Image})
+	}
+	err = pullImages("Downloading Add-on Images", options.Pull, options.PullImage, addonImages...)
+	if err != nil {
+		return nil, err
+	}
+
+	fmt.Println(fmt.Sprintf("Starting %d add-ons...", len(addons)))
+	env.addons, err = startAddons(options.AppName, options.Stack, addons, hostIP, publishPorts)
+	if err != nil {
+		return nil, err
+	}
+	for name, value := range env.addons.ConfigVars {
+		if _, ok := env.ConfigVars[name]; !ok {
+			env.ConfigVars[name] = value
+		}
+	}
+	env.Network.ContainerID = env.addons.NetContainerID
+	return env, nil
+}
+
+// Close stops the add-ons
+func (e *runtimeEnv) Close() {
+	if e.addons != nil {
+		e.addons.Close()
+	}
+}
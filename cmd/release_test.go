@@ -0,0 +1,54 @@
+package main
+
+import (
+	"io/ioutil"
+	"os"
+	"testing"
+
+	"github.com/heroku/tatara/heroku"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestStartRuntimeEnv(t *testing.T) {
+	dir, err := ioutil.TempDir("", "app")
+	assert.Nil(t, err)
+	defer os.RemoveAll(dir)
+
+	writeTestApp(t, dir, map[string]string{
+		"app.json": `{"env": {"RACK_ENV": {"value": "production"}, "SECRET": {"required": true}, "WORKERS": "2"}}`,
+		"heroku.yml": `build:
+  config:
+    RAILS_ENV: development
+`,
+	})
+
+	env, err := startRuntimeEnv(runtimeOptions{
+		AppName:     "myapp",
+		AppDir:      dir,
+		UserEnvVars: map[string]string{"WORKERS": "4", "SECRET": "xyz"},
+	}, "127.0.0.1", nil)
+	assert.Nil(t, err)
+	defer env.Close()
+
+	// build config vars aren't set at runtime
+	assert.Equal(t, map[string]string{
+		"RACK_ENV": "production",
+		"SECRET":   "xyz",
+		"WORKERS":  "4",
+	}, env.ConfigVars)
+	assert.Equal(t, "127.0.0.1", env.Network.HostIP)
+	assert.Empty(t, env.Network.ContainerID)
+}
+
+func TestAddonVolume(t *testing.T) {
+	assert.Equal(t, "tatara-myapp-postgresql", addonVolume("myapp", heroku.Addon{Plan: "heroku-postgresql"}))
+	assert.Equal(t, "tatara-my-app-cache", addonVolume("my/app", heroku.Addon{Plan: "heroku-redis", As: "CACHE"}))
+
+	yamlAddons := []heroku.Addon{{Plan: "heroku-redis"}}
+	jsonAddons := []heroku.Addon{{Plan: "heroku-postgresql"}}
+	var herokuConfig heroku.Config
+	appJSON := heroku.AppJSON{Addons: jsonAddons}
+	assert.Equal(t, jsonAddons, appAddons(herokuConfig, appJSON))
+	herokuConfig.Setup.Addons = yamlAddons
+	assert.Equal(t, yamlAddons, appAddons(herokuConfig, appJSON))
+}
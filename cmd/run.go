@@ -3,33 +3,39 @@ package main
 import (
 	"errors"
 	"fmt"
+	"io"
+	"io/ioutil"
+	"math/rand"
+	"net"
+	"net/http"
+	"net/url"
 	"os"
 	"path/filepath"
+	"regexp"
 	"strconv"
 	"strings"
+	"time"
 
 	"github.com/buildpack/forge"
 	"github.com/buildpack/forge/engine"
 	"github.com/buildpack/forge/engine/docker"
 	"github.com/fatih/color"
+	"github.com/heroku/tatara/appfiles"
+	"github.com/heroku/tatara/buildpack"
 	"github.com/heroku/tatara/cli"
 	"github.com/heroku/tatara/fs"
 	"github.com/heroku/tatara/heroku"
-	"github.com/heroku/tatara/ui"
+	"github.com/heroku/tatara/router"
 	"github.com/heroku/tatara/util"
 )
 
-const (
-	RunStack = "packs/heroku-16:run"
-)
-
 var cmdRun = cli.Command{
 	Name: "run",
 
 	Flags: []cli.Flag{
 		cli.StringFlag{
 			Name:  "stack",
-			Usage: "The name of the packs stack image to use",
+			Usage: "The stack or run image to use (defaults to the run image of the build)",
 		},
 		cli.StringFlag{
 			Name:  "process-type",
@@ -43,14 +49,33 @@ var cmdRun = cli.Command{
 			Name:  "port",
 			Usage: "The local port to use",
 		},
-		cli.BoolFlag{
-			Name:  "skip-stack-pull",
-			Usage: "Use a local stack image only",
-		},
+		pullFlag,
+		skipStackPullFlag,
 		cli.StringSliceFlag{
 			Name:  "env",
 			Usage: "A single environment variable",
 		},
+		envFileFlag,
+		cli.StringFlag{
+			Name:  "formation",
+			Usage: "The process types to run from the Procfile, e.g. web=1,worker=2",
+		},
+		cli.BoolFlag{
+			Name:  "all",
+			Usage: "Run one dyno of every process type in the Procfile",
+		},
+		cli.StringFlag{
+			Name:  "size",
+			Usage: "The dyno size to emulate memory limits for, e.g. standard-1x",
+		},
+		cli.BoolFlag{
+			Name:  "router",
+			Usage: "Proxy requests to the web dyno through a local Heroku router",
+		},
+		cli.BoolFlag{
+			Name:  "watch",
+			Usage: "Restage and restart the app when files in the app directory change",
+		},
 		cli.BoolFlag{
 			Name:  "debug",
 			Usage: "Enable debug logging",
@@ -58,52 +83,108 @@ var cmdRun = cli.Command{
 	},
 
 	Run: func(c *cli.Context) (int, error) {
-		if len(c.Args) != 1 {
-			fmt.Fprintln(c.App.UserErr, "required arguments: <app name>")
+		watch := c.Flags.Bool("watch")
+		if watch && len(c.Args) != 2 {
+			fmt.Fprintln(c.App.UserErr, "required arguments: <app directory> <app name>")
+			return cli.ExitStatusInvalidArgs, errors.New("invalid arguments")
+		} else if !watch && len(c.Args) < 1 {
+			fmt.Fprintln(c.App.UserErr, "required arguments: <app name> [-- <command>]")
 			return cli.ExitStatusInvalidArgs, errors.New("invalid arguments")
 		}
 
 		appName := filepath.Clean(c.Args[0])
-		envVarsList := c.Flags.StringSlice("env")
+		var command []string
+		if watch {
+			appName = filepath.Clean(c.Args[1])
+		} else {
+			command = c.Args[1:]
+		}
+		oneOff := len(command) > 0
+		if oneOff && (c.Flags.Bool("shell") || c.Flags.String("process-type") != "") {
+			fmt.Fprintln(c.App.UserErr, "a command cannot be combined with --shell or --process-type")
+			return cli.ExitStatusInvalidArgs, errors.New("invalid arguments")
+		}
+
+		formation := c.Flags.String("formation")
+		all := c.Flags.Bool("all")
+		if (formation != "" || all) && (watch || oneOff || c.Flags.Bool("shell") || c.Flags.String("process-type") != "") {
+			fmt.Fprintln(c.App.UserErr, "--formation and --all cannot be combined with a command, --watch, --shell or --process-type")
+			return cli.ExitStatusInvalidArgs, errors.New("invalid arguments")
+		}
+
+		useRouter := c.Flags.Bool("router")
+		if useRouter && (formation != "" || all || oneOff || c.Flags.Bool("shell")) {
+			fmt.Fprintln(c.App.UserErr, "--router cannot be combined with a command, --formation, --all or --shell")
+			return cli.ExitStatusInvalidArgs, errors.New("invalid arguments")
+		}
+		// only web dynos receive requests, on the default port if none is given
+		if processType := c.Flags.String("process-type"); useRouter && processType != "" && processType != "web" {
+			fmt.Fprintln(c.App.UserErr, "--router can only be used with the web process type")
+			return cli.ExitStatusInvalidArgs, errors.New("invalid arguments")
+		}
+
+		var size *dynoSize
+		if sizeName := c.Flags.String("size"); sizeName != "" {
+			s, ok := dynoSizes[sizeName]
+			if !ok {
+				fmt.Fprintln(c.App.UserErr, fmt.Sprintf("unknown dyno size %s, valid sizes: %s", sizeName, strings.Join(dynoSizeNames(), ", ")))
+				return cli.ExitStatusInvalidArgs, errors.New("invalid arguments")
+			}
+			size = &s
+		}
+
 		debug := c.Flags.Bool("debug")
 		shell := c.Flags.Bool("shell")
 
-		stack := c.Flags.String("stack")
-		if stack == "" {
-			stack = RunStack
+		sysFS := &fs.FS{}
+		slugPath := fmt.Sprintf("./%s.slug", appName)
+		if _, err := os.Stat(slugPath); err != nil {
+			return cli.ExitStatusInvalidArgs, err
+		}
+
+		manifest, err := readSlugManifest(slugPath)
+		if err != nil {
+			fmt.Fprintln(c.App.UserErr, err.Error())
+			return cli.ExitStatusInvalidArgs, err
 		}
 
-		envVars := make(map[string]string)
-		for _, env := range envVarsList {
-			parts := strings.SplitN(env, "=", 2)
-			name := parts[0]
-			value := parts[1]
-			envVars[name] = value
+		envVars, err := loadEnvVars(c, manifest.AppDir)
+		if err != nil {
+			fmt.Fprintln(c.App.UserErr, err.Error())
+			return cli.ExitStatusInvalidArgs, err
 		}
 
 		processType := c.Flags.String("process-type")
+		dynoName := "web.1"
 		if processType != "" {
-			envVars["DYNO"] = fmt.Sprintf("%s.1", processType)
+			dynoName = fmt.Sprintf("%s.1", processType)
+			envVars["DYNO"] = dynoName
+		} else if oneOff {
+			dynoName = oneOffDynoName("run")
+			envVars["DYNO"] = dynoName
 		}
 
 		port := c.Flags.Int("port")
 		if port != 0 {
 			envVars["PORT"] = strconv.FormatUint(uint64(port), 10)
-		} else if !shell && (processType == "" || processType == "web") {
+		} else if !shell && !oneOff && (processType == "" || processType == "web") {
 			port = 5000
 		}
+		if useRouter && port <= 0 {
+			fmt.Fprintln(c.App.UserErr, "--router requires a port to listen on")
+			return cli.ExitStatusInvalidArgs, errors.New("invalid arguments")
+		}
 
-		sysFS := &fs.FS{}
-		slugFile, slugSize, err := sysFS.ReadFile(fmt.Sprintf("./%s.slug", appName))
-		if err != nil {
-			return cli.ExitStatusInvalidArgs, err
+		stack, localStack := slugRunImage(manifest, c.Flags.String("stack"))
+		if debug {
+			fmt.Println(fmt.Sprintf("Using image: %s", stack))
 		}
-		slug := engine.NewStream(slugFile, slugSize)
-		defer slug.Close()
 
 		app := &forge.AppConfig{
-			Name:       appName,
-			RunningEnv: envVars,
+			Name: appName,
+		}
+		if oneOff {
+			app.Command = shellJoin(command)
 		}
 
 		engine, err := docker.New(&engine.EngineConfig{
@@ -114,47 +195,160 @@ var cmdRun = cli.Command{
 		}
 		defer engine.Close()
 
-		if !c.Flags.Bool("skip-stack-pull") {
-			err = ui.Loading("Downloading Runtime Image", engine.NewImage().Pull(stack))
-			if err != nil {
-				return cli.ExitStatusUnknownError, err
-			}
+		pull, err := readPullPolicy(c)
+		if err != nil {
+			fmt.Fprintln(c.App.UserErr, err.Error())
+			return cli.ExitStatusInvalidArgs, err
+		}
+		err = prepareRunImage(stack, localStack, pull, engine.NewImage().Pull)
+		if err != nil {
+			fmt.Fprintln(c.App.UserErr, err.Error())
+			return cli.ExitStatusUnknownError, err
 		}
 
 		util.WarnIfGitAutoCrlfEnabled()
 
-		curDir, err := os.Getwd()
+		herokuConfig, err := readHerokuConfig(manifest.AppDir)
 		if err != nil {
-			return cli.ExitStatusUnknownError, err
+			fmt.Fprintln(c.App.UserErr, err.Error())
+			return cli.ExitStatusInvalidArgs, err
+		}
+		appJSON, err := readAppJSON(manifest.AppDir)
+		if err != nil {
+			fmt.Fprintln(c.App.UserErr, err.Error())
+			return cli.ExitStatusInvalidArgs, err
 		}
 
-		herokuConfig, err := heroku.ReadConfig(curDir)
-		if err == nil {
-			imageName := fmt.Sprintf("%s:run", herokuConfig.Id)
-			if debug {
-				fmt.Println(fmt.Sprintf("Using image: %s", imageName))
+		useFormation := formation != "" || all
+		var dynos []dyno
+		if useFormation {
+			procfile, err := heroku.ReadSlugProcfile(slugPath)
+			if err != nil {
+				fmt.Fprintln(c.App.UserErr, err.Error())
+				return cli.ExitStatusInvalidArgs, err
+			}
+
+			processes := procfile.DefaultFormation()
+			if formation != "" {
+				processes, err = heroku.ParseFormation(formation)
+				if err != nil {
+					fmt.Fprintln(c.App.UserErr, err.Error())
+					return cli.ExitStatusInvalidArgs, err
+				}
+			}
+
+			dynos, err = formationDynos(procfile, processes, port)
+			if err != nil {
+				fmt.Fprintln(c.App.UserErr, err.Error())
+				return cli.ExitStatusInvalidArgs, err
 			}
-			stack = imageName
 		}
 
 		netConfig := &forge.NetworkConfig{
 			HostIP: "127.0.0.1",
 		}
+		hostPort := port
+		if useRouter {
+			hostPort, err = freePort(netConfig.HostIP)
+			if err != nil {
+				return cli.ExitStatusUnknownError, err
+			}
+		}
 		if port > 0 {
-			netConfig.HostPort = strconv.FormatUint(uint64(port), 10)
+			netConfig.HostPort = strconv.FormatUint(uint64(hostPort), 10)
 			netConfig.ContainerPort = strconv.FormatUint(uint64(port), 10)
 		}
 
-		runner := forge.NewRunner(engine)
-		runner.Logs = color.Output
+		publishPorts := map[int]int{}
+		if useFormation {
+			for _, d := range dynos {
+				if d.Web {
+					publishPorts[d.Port] = d.Port
+				}
+			}
+		} else if port > 0 {
+			publishPorts[port] = hostPort
+		}
+		runtime, err := startRuntimeEnv(runtimeOptions{
+			AppName:     appName,
+			AppDir:      manifest.AppDir,
+			Stack:       stack,
+			UserEnvVars: envVars,
+			Pull:        pull,
+			PullImage:   engine.NewImage().Pull,
+		}, netConfig.HostIP, publishPorts)
+		if err != nil {
+			fmt.Fprintln(c.App.UserErr, err.Error())
+			return cli.ExitStatusUnknownError, err
+		}
+		defer runtime.Close()
+		app.RunningEnv = runtime.ConfigVars
+		netConfig.ContainerID = runtime.Network.ContainerID
 
-		if port > 0 {
+		bootPorts := map[string]int{}
+		if useFormation {
+			for _, d := range dynos {
+				if d.Web {
+					bootPorts[d.Name] = d.Port
+				}
+			}
+		} else if port > 0 {
+			bootPorts[dynoName] = hostPort
+		}
+
+		exit := c.Exit
+		var manager *dynoManager
+		if !shell {
+			manager, err = startDynoManager(stack, size, netConfig.HostIP, bootPorts, color.Output)
+			if err != nil {
+				return cli.ExitStatusUnknownError, err
+			}
+			defer manager.Close()
+			exit = manager.Exit(c.Exit)
+		}
+
+		if useFormation {
+			fmt.Println(fmt.Sprintf("Running %s with %d dynos...", appName, len(dynos)))
+			err = runFormation(exit, sysFS, slugPath, dynos, forge.RunConfig{
+				Stack:         stack,
+				Color:         color.GreenString,
+				AppConfig:     app,
+				NetworkConfig: netConfig,
+				WorkingDir:    "/app",
+				OutputDir:     "/",
+			}, manager)
+			if err != nil {
+				return cli.ExitStatusUnknownError, err
+			}
+			return cli.ExitStatusSuccess, nil
+		}
+
+		if useRouter {
+			target, err := url.Parse(fmt.Sprintf("http://%s:%d", netConfig.HostIP, hostPort))
+			if err != nil {
+				return cli.ExitStatusUnknownError, err
+			}
+			server := &http.Server{
+				Addr:    fmt.Sprintf("%s:%d", netConfig.HostIP, port),
+				Handler: router.New(target, dynoName, port, color.Output),
+			}
+			go func() {
+				if err := server.ListenAndServe(); err != nil && err != http.ErrServerClosed {
+					fmt.Fprintln(c.App.UserErr, fmt.Sprintf("Router failed: %s", err))
+				}
+			}()
+			defer server.Close()
+		}
+
+		if oneOff {
+			fmt.Println(fmt.Sprintf("Running %s on %s (%s)...", strings.Join(command, " "), appName, dynoName))
+		} else if port > 0 {
 			fmt.Println(fmt.Sprintf("Running %s on port %d...", appName, port))
 		} else {
 			fmt.Println(fmt.Sprintf("Running %s...", appName))
 		}
-		_, err = runner.Run(&forge.RunConfig{
-			Droplet:       slug,
+
+		runConfig := forge.RunConfig{
 			Stack:         stack,
 			Color:         color.GreenString,
 			AppConfig:     app,
@@ -162,11 +356,261 @@ var cmdRun = cli.Command{
 			WorkingDir:    "/app",
 			OutputDir:     "/",
 			Shell:         shell,
+		}
+
+		if !watch {
+			status, err := runSlug(exit, sysFS, slugPath, color.Output, runConfig, manager)
+			if err != nil {
+				return cli.ExitStatusUnknownError, err
+			}
+			return int(status), nil
+		}
+
+		appDir := filepath.Clean(c.Args[0])
+		stackName := manifest.Stack.Name
+		if stackName == "" {
+			stackName = HerokuStack
+		}
+		slugStack, err := lookupStack(stackName)
+		if err != nil {
+			fmt.Fprintln(c.App.UserErr, err.Error())
+			return cli.ExitStatusInvalidArgs, err
+		}
+		lock, err := heroku.ReadLockfile(appDir)
+		if err != nil {
+			fmt.Fprintln(c.App.UserErr, err.Error())
+			return cli.ExitStatusInvalidArgs, err
+		}
+		buildStack := slugStack.BuildImage
+		if pinned, ok := lock.PinnedStack(slugStack); ok {
+			buildStack = pinned.BuildRef()
+		}
+		herokuConfig, err = readHerokuConfig(appDir)
+		if err != nil {
+			fmt.Fprintln(c.App.UserErr, err.Error())
+			return cli.ExitStatusInvalidArgs, err
+		}
+		if len(herokuConfig.ConstructDockerfile(buildStack)) > 0 {
+			buildStack = fmt.Sprintf("%s:build", herokuConfig.Id)
+		}
+		userEnvVars, err := loadEnvVars(c, appDir)
+		if err != nil {
+			fmt.Fprintln(c.App.UserErr, err.Error())
+			return cli.ExitStatusInvalidArgs, err
+		}
+
+		// the app is restaged with the buildpacks and config vars it was
+		// built with
+		stager := forge.NewStager(&envDirEngine{
+			Engine: engine,
+			Env:    buildEnvVars(appJSON, herokuConfig, userEnvVars),
 		})
 
+		// restages are written outside of the app directory, so that they
+		// don't trigger another restage
+		workDir, err := ioutil.TempDir("", fmt.Sprintf("tatara-%s-", appName))
 		if err != nil {
 			return cli.ExitStatusUnknownError, err
 		}
-		return cli.ExitStatusSuccess, nil
+		defer os.RemoveAll(workDir)
+		restagePath := filepath.Join(workDir, fmt.Sprintf("%s.slug", appName))
+		restageCache := filepath.Join(workDir, fmt.Sprintf(".%s.cache", appName))
+		if err := copyFile(fmt.Sprintf("./.%s.cache", appName), restageCache); err != nil && !os.IsNotExist(err) {
+			return cli.ExitStatusUnknownError, err
+		}
+
+		ignored, err := watchIgnored(appDir, appfiles.Options{})
+		if err != nil {
+			return cli.ExitStatusUnknownError, err
+		}
+		change, done, err := sysFS.Watch(appDir, time.Second, ignored)
+		if err != nil {
+			return cli.ExitStatusUnknownError, err
+		}
+		defer close(done)
+
+		for {
+			stop := make(chan struct{})
+			restart := make(chan bool, 1)
+			go func() {
+				defer close(stop)
+				for {
+					select {
+					case <-exit:
+						restart <- false
+						return
+					case <-change:
+						fmt.Println(fmt.Sprintf("Change detected, restaging %s...", appName))
+						started := time.Now()
+						staged, err := stageApp(stager, sysFS, &stageOptions{
+							AppDir:         appDir,
+							AppName:        appName,
+							Stack:          slugStack,
+							BuildStack:     buildStack,
+							Buildpacks:     manifest.Buildpacks,
+							SlugPath:       restagePath,
+							CachePath:      restageCache,
+							BuildpackCache: &buildpack.Cache{Dir: buildpack.DefaultCacheDir()},
+							Lock:           lock,
+						})
+						if err != nil {
+							fmt.Fprintln(c.App.UserErr, fmt.Sprintf("Restaging failed: %s", err))
+							continue
+						}
+						manifest.Buildpacks = staged.Buildpacks
+						manifest.Stack.BuildImage = buildStack
+						// the app's slug and cache are replaced once the
+						// restage is complete, so that they stay current
+						// after watching stops
+						if err := keepRestage(restagePath, restageCache, appName); err != nil {
+							fmt.Fprintln(c.App.UserErr, fmt.Sprintf("Could not save restaged slug: %s", err))
+						} else if err := writeSlugManifest(appDir, fmt.Sprintf("./%s.slug", appName), manifest, started); err != nil {
+							fmt.Fprintln(c.App.UserErr, fmt.Sprintf("Could not write slug manifest: %s", err))
+						}
+						slugPath = restagePath
+						if manager != nil {
+							manager.Stop()
+						}
+						restart <- true
+						return
+					}
+				}
+			}()
+
+			_, err = runSlug(stop, sysFS, slugPath, color.Output, runConfig, manager)
+			if err != nil {
+				fmt.Fprintln(c.App.UserErr, fmt.Sprintf("Error running %s: %s", appName, err))
+			}
+			if !<-restart {
+				return cli.ExitStatusSuccess, nil
+			}
+			fmt.Println(fmt.Sprintf("Restarting %s...", appName))
+		}
 	},
 }
+
+// oneOffDynoName numbers a one-off dyno the way Heroku does, e.g. run.4721
+func oneOffDynoName(processType string) string {
+	return fmt.Sprintf("%s.%d", processType, 1000+rand.New(rand.NewSource(time.Now().UnixNano())).Intn(9000))
+}
+
+var shellSafe = regexp.MustCompile(`^[A-Za-z0-9_./:=@%+,-]+$`)
+
+// shellJoin quotes each argument so that the shell in the dyno sees the same
+// arguments that were passed to tatara
+func shellJoin(args []string) string {
+	quoted := make([]string, len(args))
+	for i, arg := range args {
+		if shellSafe.MatchString(arg) {
+			quoted[i] = arg
+		} else {
+			quoted[i] = "'" + strings.Replace(arg, "'", `'\''`, -1) + "'"
+		}
+	}
+	return strings.Join(quoted, " ")
+}
+
+// watchIgnored returns a filter for the changes to the app directory that
+// are left out of the app, like tatara's own outputs
+func watchIgnored(appDir string, options appfiles.Options) (fs.IgnoreFunc, error) {
+	absAppDir, err := filepath.Abs(appDir)
+	if err != nil {
+		return nil, err
+	}
+	filter, err := appfiles.NewFilter(absAppDir, options)
+	if err != nil {
+		return nil, err
+	}
+	return func(path string, isDir bool) bool {
+		absPath, err := filepath.Abs(path)
+		if err != nil {
+			return false
+		}
+		relPath, err := filepath.Rel(absAppDir, absPath)
+		if err != nil || relPath == "." || strings.HasPrefix(relPath, "..") {
+			return false
+		}
+		relPath = filepath.ToSlash(relPath)
+
+		// files in ignored directories are ignored too
+		parts := strings.Split(relPath, "/")
+		for i := 1; i < len(parts); i++ {
+			if ignored, _ := filter.Ignored(strings.Join(parts[:i], "/"), true); ignored {
+				return true
+			}
+		}
+		ignored, _ := filter.Ignored(relPath, isDir)
+		return ignored
+	}, nil
+}
+
+// keepRestage replaces the slug and cache of an app in the working directory
+// with a restaged slug and its cache
+func keepRestage(restagePath, restageCache, appName string) error {
+	if err := copyFile(restagePath, fmt.Sprintf("./%s.slug", appName)); err != nil {
+		return err
+	}
+	if err := copyFile(restageCache, fmt.Sprintf("./.%s.cache", appName)); err != nil && !os.IsNotExist(err) {
+		return err
+	}
+	return nil
+}
+
+// copyFile copies the file at src to dst
+func copyFile(src, dst string) error {
+	in, err := os.Open(src)
+	if err != nil {
+		return err
+	}
+	defer in.Close()
+	out, err := os.Create(dst)
+	if err != nil {
+		return err
+	}
+	if _, err := io.Copy(out, in); err != nil {
+		out.Close()
+		return err
+	}
+	return out.Close()
+}
+
+// freePort finds a port on hostIP that nothing is listening on
+func freePort(hostIP string) (int, error) {
+	listener, err := net.Listen("tcp", fmt.Sprintf("%s:0", hostIP))
+	if err != nil {
+		return 0, err
+	}
+	defer listener.Close()
+	return listener.Addr().(*net.TCPAddr).Port, nil
+}
+
+// runSlug runs the slug at slugPath until it exits or exit is closed. The
+// container is managed by the dyno manager, if there is one.
+// Each call uses its own engine so that a single run can be stopped without
+// stopping the rest of tatara.
+func runSlug(exit <-chan struct{}, sysFS *fs.FS, slugPath string, logs io.Writer, config forge.RunConfig, manager *dynoManager) (int64, error) {
+	slugFile, slugSize, err := sysFS.ReadFile(slugPath)
+	if err != nil {
+		return 0, err
+	}
+	slug := engine.NewStream(slugFile, slugSize)
+	defer slug.Close()
+
+	engine, err := docker.New(&engine.EngineConfig{
+		Exit: exit,
+	})
+	if err != nil {
+		return 0, err
+	}
+	defer engine.Close()
+
+	var runEngine forge.Engine = engine
+	if manager != nil {
+		runEngine = manager.Engine(engine)
+	}
+	runner := forge.NewRunner(runEngine)
+	runner.Logs = logs
+
+	config.Droplet = slug
+	return runner.Run(&config)
+}
@@ -0,0 +1,88 @@
+package main
+
+import (
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/heroku/tatara/appfiles"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestWatchIgnored(t *testing.T) {
+	dir, err := ioutil.TempDir("", "app")
+	assert.Nil(t, err)
+	defer os.RemoveAll(dir)
+
+	writeTestApp(t, dir, map[string]string{
+		".gitignore":        "node_modules/\n*.log\n",
+		".slugignore":       "docs\n",
+		"app.rb":            "",
+		"lib/lib.rb":        "",
+		"node_modules/x.js": "",
+	})
+	ignored, err := watchIgnored(dir, appfiles.Options{})
+	assert.Nil(t, err)
+
+	for path, isDir := range map[string]bool{
+		"myapp.slug":                false,
+		"myapp.slug.json":           false,
+		".myapp.cache":              false,
+		"myapp.slug.tmp":            false,
+		".slug-tar-123":             false,
+		"tatara.lock":               false,
+		"debug.log":                 false,
+		"docs":                      true,
+		"docs/README":               false,
+		"node_modules":              true,
+		"node_modules/x.js":         false,
+		".git":                      true,
+		".git/index":                false,
+		".git/refs/heads/master":    false,
+		"node_modules/dep/index.js": false,
+	} {
+		assert.True(t, ignored(filepath.Join(dir, path), isDir), path)
+	}
+
+	for path, isDir := range map[string]bool{
+		"app.rb":     false,
+		"lib":        true,
+		"lib/lib.rb": false,
+		"Procfile":   false,
+		".gitignore": false,
+	} {
+		assert.False(t, ignored(filepath.Join(dir, path), isDir), path)
+	}
+	assert.False(t, ignored(dir, true))
+	assert.False(t, ignored(filepath.Join(filepath.Dir(dir), "other.slug"), false))
+}
+
+func TestShellJoin(t *testing.T) {
+	assert.Equal(t, "bundle exec rake db:migrate", shellJoin([]string{"bundle", "exec", "rake", "db:migrate"}))
+	assert.Equal(t, `echo 'hello world' '$HOME' 'it'\''s' ''`, shellJoin([]string{"echo", "hello world", "$HOME", "it's", ""}))
+	assert.Equal(t, "ls -la ./app/bin a=b user@host:80", shellJoin([]string{"ls", "-la", "./app/bin", "a=b", "user@host:80"}))
+}
+
+func TestKeepRestage(t *testing.T) {
+	dir, err := ioutil.TempDir("", "watch")
+	assert.Nil(t, err)
+	defer os.RemoveAll(dir)
+	wd, err := os.Getwd()
+	assert.Nil(t, err)
+	defer os.Chdir(wd)
+	assert.Nil(t, os.Chdir(dir))
+
+	assert.Nil(t, os.Mkdir("work", 0755))
+	assert.Nil(t, ioutil.WriteFile("myapp.slug", []byte("old slug"), 0644))
+	assert.Nil(t, ioutil.WriteFile(filepath.Join("work", "myapp.slug"), []byte("new slug"), 0644))
+	assert.Nil(t, ioutil.WriteFile(filepath.Join("work", ".myapp.cache"), []byte("new cache"), 0644))
+
+	assert.Nil(t, keepRestage(filepath.Join("work", "myapp.slug"), filepath.Join("work", ".myapp.cache"), "myapp"))
+	slug, err := ioutil.ReadFile("myapp.slug")
+	assert.Nil(t, err)
+	assert.Equal(t, "new slug", string(slug))
+	cache, err := ioutil.ReadFile(".myapp.cache")
+	assert.Nil(t, err)
+	assert.Equal(t, "new cache", string(cache))
+}
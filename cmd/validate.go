@@ -0,0 +1,94 @@
+package main
+
+import (
+	"errors"
+	"fmt"
+	"os"
+	"path/filepath"
+
+	"github.com/heroku/tatara/buildpack"
+	"github.com/heroku/tatara/cli"
+	"github.com/heroku/tatara/heroku"
+)
+
+var cmdValidate = cli.Command{
+	Name: "validate",
+
+	Flags: []cli.Flag{
+		cli.StringFlag{
+			Name:  "buildpack-registry",
+			Usage: "The base URL of the buildpack registry",
+		},
+	},
+
+	Run: func(c *cli.Context) (int, error) {
+		if len(c.Args) != 1 {
+			fmt.Fprintln(c.App.UserErr, "required arguments: <app directory>")
+			return cli.ExitStatusInvalidArgs, errors.New("invalid arguments")
+		}
+
+		appDir := filepath.Clean(c.Args[0])
+		invalid := 0
+		report := func(file string, err error) {
+			switch {
+			case os.IsNotExist(err):
+				fmt.Fprintln(c.App.UserOut, fmt.Sprintf("%s: not found", file))
+			case err != nil:
+				fmt.Fprintln(c.App.UserErr, err.Error())
+				invalid++
+			default:
+				fmt.Fprintln(c.App.UserOut, fmt.Sprintf("%s: ok", file))
+			}
+		}
+
+		herokuConfig, err := heroku.ReadConfig(appDir)
+		registry := buildpack.RegistryURL(c.Flags.String("buildpack-registry"), herokuConfig.Build.Registry)
+		if err == nil {
+			if _, resolveErr := herokuConfig.ResolveBuildpacks(registry); resolveErr != nil {
+				err = &heroku.FileError{File: "heroku.yml", Message: resolveErr.Error()}
+			}
+		}
+		report("heroku.yml", err)
+
+		report("Procfile", validateProcfile(appDir))
+
+		appJSON, err := heroku.ReadAppJSON(appDir)
+		if err == nil {
+			err = validateAppJSON(appJSON, registry)
+		}
+		report("app.json", err)
+
+		if invalid > 0 {
+			return cli.ExitStatusInvalidArgs, fmt.Errorf("%d invalid files", invalid)
+		}
+		return cli.ExitStatusSuccess, nil
+	},
+}
+
+func validateProcfile(appDir string) error {
+	procfile, err := os.Open(filepath.Join(appDir, "Procfile"))
+	if err != nil {
+		return err
+	}
+	defer procfile.Close()
+
+	_, err = heroku.ParseProcfile(procfile)
+	return err
+}
+
+// validateAppJSON checks that the stack and buildpacks of an app.json exist
+func validateAppJSON(appJSON heroku.AppJSON, registry string) error {
+	var errs heroku.FileErrors
+	if appJSON.Stack != "" {
+		if _, err := lookupStack(appJSON.Stack); err != nil {
+			errs = append(errs, &heroku.FileError{File: "app.json", Message: err.Error()})
+		}
+	}
+	if _, err := appJSON.ResolveBuildpacks(registry); err != nil {
+		errs = append(errs, &heroku.FileError{File: "app.json", Message: err.Error()})
+	}
+	if len(errs) > 0 {
+		return errs
+	}
+	return nil
+}
@@ -0,0 +1,12 @@
+package fs
+
+import "os"
+
+// IgnoreFunc reports whether changes to a path should be ignored
+type IgnoreFunc func(path string, isDir bool) bool
+
+// ignoredPath checks a changed path, which may no longer exist
+func ignoredPath(path string, ignored IgnoreFunc) bool {
+	info, err := os.Lstat(path)
+	return ignored(path, err == nil && info.IsDir())
+}
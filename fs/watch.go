@@ -11,7 +11,7 @@ import (
 )
 
 // TODO: replace done chan with done func
-func (f *FS) Watch(dir string, wait time.Duration) (change <-chan time.Time, done chan<- struct{}, err error) {
+func (f *FS) Watch(dir string, wait time.Duration, ignored IgnoreFunc) (change <-chan time.Time, done chan<- struct{}, err error) {
 	watcher, err := fsnotify.NewWatcher()
 	if err != nil {
 		return nil, nil, err
@@ -19,6 +19,9 @@ func (f *FS) Watch(dir string, wait time.Duration) (change <-chan time.Time, don
 
 	if err := filepath.Walk(dir, func(path string, info os.FileInfo, err error) error {
 		if err == nil && info.Mode().IsDir() {
+			if path != dir && ignored(path, true) {
+				return filepath.SkipDir
+			}
 			watcher.Add(path) // TODO: log error
 		}
 		return nil
@@ -38,7 +41,7 @@ func (f *FS) Watch(dir string, wait time.Duration) (change <-chan time.Time, don
 			select {
 			case <-watcher.Errors: // TODO: log error
 			case event := <-watcher.Events:
-				if !hasOp(event.Op, fsnotify.Chmod) {
+				if !hasOp(event.Op, fsnotify.Chmod) && !ignoredPath(event.Name, ignored) {
 					after = time.After(wait)
 				}
 			case t = <-after:
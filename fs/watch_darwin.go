@@ -1,6 +1,7 @@
 package fs
 
 import (
+	"path/filepath"
 	"time"
 
 	"github.com/fsnotify/fsevents"
@@ -12,7 +13,7 @@ var changeEvents = []fsevents.EventFlags{
 	fsevents.ItemRenamed, fsevents.ItemModified,
 }
 
-func (f *FS) Watch(dir string, wait time.Duration) (change <-chan time.Time, done chan<- struct{}, err error) {
+func (f *FS) Watch(dir string, wait time.Duration, ignored IgnoreFunc) (change <-chan time.Time, done chan<- struct{}, err error) {
 	dev, err := fsevents.DeviceForPath(dir)
 	if err != nil {
 		return nil, nil, err
@@ -33,7 +34,7 @@ func (f *FS) Watch(dir string, wait time.Duration) (change <-chan time.Time, don
 			select {
 			case events := <-source:
 				for _, e := range events {
-					if hasFlags(e.Flags, changeEvents...) {
+					if hasFlags(e.Flags, changeEvents...) && !ignoredPath(eventPath(e), ignored) {
 						out <- time.Now()
 						break
 					}
@@ -48,6 +49,15 @@ func (f *FS) Watch(dir string, wait time.Duration) (change <-chan time.Time, don
 	return out, stop, nil
 }
 
+// eventPath returns the absolute path of an event, since streams on a
+// device report paths relative to its root
+func eventPath(e fsevents.Event) string {
+	if filepath.IsAbs(e.Path) {
+		return e.Path
+	}
+	return "/" + e.Path
+}
+
 func hasFlags(flag fsevents.EventFlags, flags ...fsevents.EventFlags) bool {
 	for _, f := range flags {
 		if flag&f == f {
@@ -0,0 +1,101 @@
+package heroku
+
+import (
+	"encoding/json"
+	"fmt"
+	"strings"
+)
+
+// Addon is an add-on from heroku.yml or app.json. It may be declared either
+// as a plan name or as an object with a plan and an attachment name.
+type Addon struct {
+	Plan string `json:"plan"`
+	As   string `json:"as"`
+}
+
+func (a *Addon) UnmarshalYAML(unmarshal func(interface{}) error) error {
+	var plan string
+	if err := unmarshal(&plan); err == nil {
+		a.Plan = plan
+		return nil
+	}
+
+	type addon Addon
+	return unmarshal((*addon)(a))
+}
+
+func (a *Addon) UnmarshalJSON(data []byte) error {
+	var plan string
+	if err := json.Unmarshal(data, &plan); err == nil {
+		a.Plan = plan
+		return nil
+	}
+
+	type addon Addon
+	return json.Unmarshal(data, (*addon)(a))
+}
+
+// Service returns the name of the add-on service without the plan,
+// e.g. heroku-postgresql for heroku-postgresql:hobby-dev
+func (a Addon) Service() string {
+	return strings.SplitN(a.Plan, ":", 2)[0]
+}
+
+// AddonService describes a local container that emulates an add-on
+type AddonService struct {
+	Image       string
+	Env         map[string]string
+	Port        int
+	HealthCheck []string
+	ConfigVar   string
+	URL         string
+	// DataDir is where the service keeps its data, which outlives the
+	// container
+	DataDir string
+}
+
+// Hostname is the network alias of the container that emulates the add-on
+func (a Addon) Hostname() string {
+	if a.As != "" {
+		return strings.Replace(strings.ToLower(a.As), "_", "-", -1)
+	}
+	return strings.TrimPrefix(a.Service(), "heroku-")
+}
+
+// LocalService returns the container that emulates the add-on
+func (a Addon) LocalService() (AddonService, error) {
+	host := a.Hostname()
+	var service AddonService
+	switch a.Service() {
+	case "heroku-postgresql":
+		service = AddonService{
+			Image: "postgres:latest",
+			Env: map[string]string{
+				"POSTGRES_USER":     "postgres",
+				"POSTGRES_PASSWORD": "postgres",
+				"POSTGRES_DB":       "postgres",
+			},
+			Port:        5432,
+			HealthCheck: []string{"CMD", "pg_isready", "-U", "postgres"},
+			ConfigVar:   "DATABASE_URL",
+			URL:         fmt.Sprintf("postgres://postgres:postgres@%s:5432/postgres", host),
+			DataDir:     "/var/lib/postgresql/data",
+		}
+	case "heroku-redis":
+		service = AddonService{
+			Image:       "redis:latest",
+			Port:        6379,
+			HealthCheck: []string{"CMD", "redis-cli", "ping"},
+			ConfigVar:   "REDIS_URL",
+			URL:         fmt.Sprintf("redis://%s:6379", host),
+			DataDir:     "/data",
+		}
+	default:
+		return AddonService{}, fmt.Errorf("add-on %s can not be emulated locally", a.Plan)
+	}
+
+	if a.As != "" {
+		service.ConfigVar = fmt.Sprintf("%s_URL", strings.ToUpper(a.As))
+	}
+	return service, nil
+}
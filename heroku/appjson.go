@@ -0,0 +1,88 @@
+package heroku
+
+import (
+	"encoding/json"
+	"errors"
+	"io/ioutil"
+	"path/filepath"
+)
+
+// AppJSON holds the parts of an app.json manifest that tatara understands
+type AppJSON struct {
+	Addons     []Addon                  `json:"addons"`
+	Buildpacks []AppJSONBuildpack       `json:"buildpacks"`
+	Stack      string                   `json:"stack"`
+	Env        map[string]AppJSONEnvVar `json:"env"`
+	Scripts    AppJSONScripts           `json:"scripts"`
+
+	appDir string
+}
+
+type AppJSONBuildpack struct {
+	URL string `json:"url"`
+}
+
+// AppJSONEnvVar is a config var from app.json, given either as an object or
+// as a plain string value
+type AppJSONEnvVar struct {
+	Description string `json:"description"`
+	Value       string `json:"value"`
+	Required    *bool  `json:"required"`
+	Generator   string `json:"generator"`
+}
+
+type AppJSONScripts struct {
+	Postdeploy string `json:"postdeploy"`
+}
+
+func (v *AppJSONEnvVar) UnmarshalJSON(data []byte) error {
+	var value string
+	if err := json.Unmarshal(data, &value); err == nil {
+		*v = AppJSONEnvVar{Value: value}
+		return nil
+	}
+
+	// errors of the inner value have offsets within it rather than within
+	// app.json, so they are replaced
+	type envVar AppJSONEnvVar
+	if err := json.Unmarshal(data, (*envVar)(v)); err != nil {
+		return errors.New("env values must be a string or an object with a value")
+	}
+	return nil
+}
+
+// ReadAppJSON reads the app.json in appDir. Invalid JSON is reported as a
+// FileError with the line and column of the problem.
+func ReadAppJSON(appDir string) (AppJSON, error) {
+	var appJSON AppJSON
+	appJSONBytes, err := ioutil.ReadFile(filepath.Join(appDir, "app.json"))
+	if err != nil {
+		return appJSON, err
+	}
+	if err := json.Unmarshal(appJSONBytes, &appJSON); err != nil {
+		return AppJSON{}, jsonFileError("app.json", appJSONBytes, err)
+	}
+	appJSON.appDir = appDir
+	return appJSON, nil
+}
+
+// ResolveBuildpacks returns the URL of every buildpack in app.json, looking
+// up buildpack names like heroku/ruby@v200 in the given registry
+func (a *AppJSON) ResolveBuildpacks(registry string) ([]string, error) {
+	refs := make([]string, len(a.Buildpacks))
+	for i, bp := range a.Buildpacks {
+		refs[i] = bp.URL
+	}
+	return resolveBuildpacks(a.appDir, registry, refs)
+}
+
+// EnvDefaults returns the config vars from app.json that have a value
+func (a *AppJSON) EnvDefaults() map[string]string {
+	env := map[string]string{}
+	for name, envVar := range a.Env {
+		if envVar.Value != "" {
+			env[name] = envVar.Value
+		}
+	}
+	return env
+}
@@ -0,0 +1,71 @@
+package heroku
+
+import (
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestReadAppJSON(t *testing.T) {
+	appDir, err := ioutil.TempDir("", "app")
+	assert.Nil(t, err)
+	defer os.RemoveAll(appDir)
+
+	err = ioutil.WriteFile(filepath.Join(appDir, "app.json"), []byte(`{
+  "stack": "heroku-18",
+  "buildpacks": [{"url": "heroku/ruby@v200"}, {"url": "./buildpacks/custom"}],
+  "env": {
+    "SECRET_TOKEN": {"description": "A secret", "generator": "secret"},
+    "WEB_CONCURRENCY": {"value": "5"},
+    "RACK_ENV": "production"
+  },
+  "scripts": {"postdeploy": "bundle exec rake db:seed"}
+}`), 0644)
+	assert.Nil(t, err)
+
+	appJSON, err := ReadAppJSON(appDir)
+	assert.Nil(t, err)
+	assert.Equal(t, "heroku-18", appJSON.Stack)
+	assert.Equal(t, "bundle exec rake db:seed", appJSON.Scripts.Postdeploy)
+	assert.Equal(t, map[string]string{
+		"WEB_CONCURRENCY": "5",
+		"RACK_ENV":        "production",
+	}, appJSON.EnvDefaults())
+
+	buildpacks, err := appJSON.ResolveBuildpacks("https://registry.example.com")
+	assert.Nil(t, err)
+	assert.Equal(t, []string{
+		"https://registry.example.com/buildpacks/heroku/ruby/v200.tgz",
+		filepath.Join(appDir, "buildpacks/custom"),
+	}, buildpacks)
+}
+
+func TestReadAppJSONErrors(t *testing.T) {
+	appDir, err := ioutil.TempDir("", "app")
+	assert.Nil(t, err)
+	defer os.RemoveAll(appDir)
+
+	err = ioutil.WriteFile(filepath.Join(appDir, "app.json"), []byte(`{
+  "stack": 18
+}`), 0644)
+	assert.Nil(t, err)
+	_, err = ReadAppJSON(appDir)
+	assert.EqualError(t, err, "app.json:2:12: stack: expected a string, got number")
+
+	err = ioutil.WriteFile(filepath.Join(appDir, "app.json"), []byte(`{
+  "buildpacks": "heroku/ruby"
+}`), 0644)
+	assert.Nil(t, err)
+	_, err = ReadAppJSON(appDir)
+	assert.EqualError(t, err, "app.json:2:17: buildpacks: expected a list, got string")
+
+	err = ioutil.WriteFile(filepath.Join(appDir, "app.json"), []byte(`{
+  "stack": "heroku-18",
+}`), 0644)
+	assert.Nil(t, err)
+	_, err = ReadAppJSON(appDir)
+	assert.EqualError(t, err, "app.json:3:1: invalid character '}' looking for beginning of object key string")
+}
@@ -4,6 +4,7 @@ import (
 	"crypto/sha256"
 	"encoding/base32"
 	"fmt"
+	"github.com/heroku/tatara/buildpack"
 	"gopkg.in/yaml.v2"
 	"io/ioutil"
 	"os"
@@ -11,9 +12,22 @@ import (
 	"strings"
 )
 
+// Config is a heroku.yml. Every documented key is accepted, though tatara
+// only builds with buildpacks, so build.docker, release and run are ignored.
 type Config struct {
-	Build BuildConfig
-	Id    string
+	Setup   SetupConfig
+	Build   BuildConfig
+	Release ReleaseConfig
+	Run     map[string]ProcessConfig
+	Id      string `yaml:"-"`
+
+	appDir string
+}
+
+type SetupConfig struct {
+	Addons []Addon
+	// Config vars are set when the app is created on Heroku
+	Config map[string]string
 }
 
 type BuildConfig struct {
@@ -22,8 +36,55 @@ type BuildConfig struct {
 	Pre        []string
 	Post       []string
 	Config     map[string]string
+	Registry   string
+	Docker     map[string]DockerBuild
+	Languages  []string
+}
+
+// DockerBuild is the Dockerfile a process type's image is built from, like
+// `web: Dockerfile` or a map with the dockerfile and a target stage
+type DockerBuild struct {
+	Dockerfile string
+	Target     string
 }
 
+func (d *DockerBuild) UnmarshalYAML(unmarshal func(interface{}) error) error {
+	var dockerfile string
+	if err := unmarshal(&dockerfile); err == nil {
+		d.Dockerfile = dockerfile
+		return nil
+	}
+
+	type dockerBuild DockerBuild
+	return unmarshal((*dockerBuild)(d))
+}
+
+// ReleaseConfig is the release phase of an app built with Docker
+type ReleaseConfig struct {
+	Image   string
+	Command []string
+}
+
+// ProcessConfig is the command of a process type of an app built with
+// Docker, like `web: bundle exec puma` or a map with the command and image
+type ProcessConfig struct {
+	Command []string
+	Image   string
+}
+
+func (p *ProcessConfig) UnmarshalYAML(unmarshal func(interface{}) error) error {
+	var command string
+	if err := unmarshal(&command); err == nil {
+		p.Command = []string{command}
+		return nil
+	}
+
+	type processConfig ProcessConfig
+	return unmarshal((*processConfig)(p))
+}
+
+// ReadConfig reads the heroku.yml in appDir. Unknown keys and values of the
+// wrong type are errors, reported as FileErrors with their line and column.
 func ReadConfig(appDir string) (Config, error) {
 	herokuYamlFile := filepath.Join(appDir, "heroku.yml")
 	_, err := os.Stat(herokuYamlFile)
@@ -31,12 +92,15 @@ func ReadConfig(appDir string) (Config, error) {
 		configBytes, err := ioutil.ReadFile(herokuYamlFile)
 		if err == nil {
 			var herokuConfig Config
-			yaml.Unmarshal(configBytes, &herokuConfig)
+			if err := yaml.UnmarshalStrict(configBytes, &herokuConfig); err != nil {
+				return Config{}, yamlFileErrors("heroku.yml", configBytes, err)
+			}
 
 			hasher := sha256.New()
 			hasher.Write(configBytes)
 			sha := strings.ToLower(base32.HexEncoding.EncodeToString(hasher.Sum(nil)))
 			herokuConfig.Id = strings.Replace(sha, "=", "x", -1)
+			herokuConfig.appDir = appDir
 
 			return herokuConfig, nil
 		}
@@ -44,16 +108,29 @@ func ReadConfig(appDir string) (Config, error) {
 	return Config{}, err
 }
 
-func (c *Config) ResolveBuildpacks() []string {
-	buildpacks := make([]string, len(c.Build.Buildpacks))
-	for i, buildpack := range c.Build.Buildpacks {
-		if strings.HasPrefix(buildpack, "https://") || strings.HasPrefix(buildpack, "http://") {
-			buildpacks[i] = buildpack
+// ResolveBuildpacks returns the URL of every buildpack in heroku.yml, looking
+// up buildpack names like heroku/ruby@v200 in the given registry
+func (c *Config) ResolveBuildpacks(registry string) ([]string, error) {
+	return resolveBuildpacks(c.appDir, registry, c.Build.Buildpacks)
+}
+
+func resolveBuildpacks(appDir, registry string, refs []string) ([]string, error) {
+	buildpacks := make([]string, len(refs))
+	for i, bp := range refs {
+		if strings.Contains(bp, "://") || strings.HasPrefix(bp, "git@") {
+			buildpacks[i] = bp
+		} else if strings.HasPrefix(bp, ".") || filepath.IsAbs(bp) {
+			// local buildpacks are relative to the app directory
+			buildpacks[i] = filepath.Join(appDir, bp)
 		} else {
-			buildpacks[i] = fmt.Sprintf("https://buildpack-registry.s3.amazonaws.com/buildpacks/%s.tgz", buildpack)
+			url, err := buildpack.RegistryArchiveURL(registry, bp)
+			if err != nil {
+				return nil, err
+			}
+			buildpacks[i] = url
 		}
 	}
-	return buildpacks
+	return buildpacks, nil
 }
 
 func (c *Config) ConstructDockerfile(stack string) string {
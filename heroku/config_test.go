@@ -0,0 +1,139 @@
+package heroku
+
+import (
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestReadConfig(t *testing.T) {
+	appDir, err := ioutil.TempDir("", "app")
+	assert.Nil(t, err)
+	defer os.RemoveAll(appDir)
+
+	_, err = ReadConfig(appDir)
+	assert.True(t, os.IsNotExist(err))
+
+	writeConfig := func(config string) {
+		err := ioutil.WriteFile(filepath.Join(appDir, "heroku.yml"), []byte(config), 0644)
+		assert.Nil(t, err)
+	}
+
+	writeConfig(`setup:
+  addons:
+  - heroku-postgresql
+  - plan: heroku-redis
+    as: CACHE
+build:
+  packages:
+  - imagemagick
+  config:
+    RAILS_ENV: development
+    WORKERS: 2
+`)
+	config, err := ReadConfig(appDir)
+	assert.Nil(t, err)
+	assert.Equal(t, []Addon{{Plan: "heroku-postgresql"}, {Plan: "heroku-redis", As: "CACHE"}}, config.Setup.Addons)
+	assert.Equal(t, []string{"imagemagick"}, config.Build.Packages)
+	assert.Equal(t, map[string]string{"RAILS_ENV": "development", "WORKERS": "2"}, config.Build.Config)
+	assert.NotEmpty(t, config.Id)
+
+	writeConfig(`build:
+  pacakges:
+  - imagemagick
+  pre: bundle exec rake assets:precompile
+`)
+	_, err = ReadConfig(appDir)
+	assert.EqualError(t, err, `heroku.yml:2:3: unknown key "pacakges" in build, expected one of buildpacks, packages, pre, post, config, registry, docker, languages
+heroku.yml:4:8: expected a list of strings, got a string "bundle exec rake assets:precompile"`)
+
+	writeConfig(`setup:
+  addons:
+  - plan: heroku-redis
+    size: 1
+biuld: {}
+`)
+	_, err = ReadConfig(appDir)
+	assert.EqualError(t, err, `heroku.yml:4:5: unknown key "size" in add-on, expected one of plan, as
+heroku.yml:5:1: unknown key "biuld", expected one of setup, build, release, run`)
+
+	writeConfig("build:\n  packages: [imagemagick\n")
+	_, err = ReadConfig(appDir)
+	if assert.IsType(t, FileErrors{}, err) {
+		assert.Equal(t, 2, err.(FileErrors)[0].Line)
+	}
+}
+
+func TestReadConfigDocumentedKeys(t *testing.T) {
+	appDir, err := ioutil.TempDir("", "app")
+	assert.Nil(t, err)
+	defer os.RemoveAll(appDir)
+
+	// the example from Heroku's heroku.yml documentation
+	err = ioutil.WriteFile(filepath.Join(appDir, "heroku.yml"), []byte(`setup:
+  addons:
+    - plan: heroku-postgresql
+      as: DATABASE
+  config:
+    S3_BUCKET: my-example-bucket
+build:
+  docker:
+    web: Dockerfile
+    worker:
+      dockerfile: worker/Dockerfile
+      target: production
+  config:
+    RAILS_ENV: development
+    FOO: bar
+release:
+  command:
+    - ./deployment-tasks.sh
+  image: worker
+run:
+  web: bundle exec puma -C config/puma.rb
+  worker: python myworker.py
+  asset-syncer:
+    command:
+      - python asset-syncer.py
+    image: worker
+`), 0644)
+	assert.Nil(t, err)
+
+	config, err := ReadConfig(appDir)
+	assert.Nil(t, err)
+	assert.Equal(t, []Addon{{Plan: "heroku-postgresql", As: "DATABASE"}}, config.Setup.Addons)
+	assert.Equal(t, map[string]string{"S3_BUCKET": "my-example-bucket"}, config.Setup.Config)
+	assert.Equal(t, map[string]DockerBuild{
+		"web":    {Dockerfile: "Dockerfile"},
+		"worker": {Dockerfile: "worker/Dockerfile", Target: "production"},
+	}, config.Build.Docker)
+	assert.Equal(t, map[string]string{"RAILS_ENV": "development", "FOO": "bar"}, config.Build.Config)
+	assert.Equal(t, ReleaseConfig{Command: []string{"./deployment-tasks.sh"}, Image: "worker"}, config.Release)
+	assert.Equal(t, map[string]ProcessConfig{
+		"web":          {Command: []string{"bundle exec puma -C config/puma.rb"}},
+		"worker":       {Command: []string{"python myworker.py"}},
+		"asset-syncer": {Command: []string{"python asset-syncer.py"}, Image: "worker"},
+	}, config.Run)
+
+	err = ioutil.WriteFile(filepath.Join(appDir, "heroku.yml"), []byte(`run:
+  web:
+    comand: bundle exec puma
+release:
+  imgae: worker
+`), 0644)
+	assert.Nil(t, err)
+	_, err = ReadConfig(appDir)
+	assert.EqualError(t, err, `heroku.yml:3:5: unknown key "comand" in process type, expected one of command, image
+heroku.yml:5:3: unknown key "imgae" in release, expected one of image, command`)
+}
+
+func TestPosition(t *testing.T) {
+	source := []byte("{\n  \"stack\": 1\n}")
+	line, col := position(source, 0)
+	assert.Equal(t, []int{1, 1}, []int{line, col})
+	line, col = position(source, 13)
+	assert.Equal(t, []int{2, 12}, []int{line, col})
+}
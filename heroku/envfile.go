@@ -0,0 +1,134 @@
+package heroku
+
+import (
+	"bufio"
+	"fmt"
+	"io"
+	"os"
+	"regexp"
+	"strings"
+)
+
+var envVarName = regexp.MustCompile(`^[A-Za-z_][A-Za-z0-9_.]*$`)
+
+// ValidEnvVarName reports whether name can be used as a config var name
+func ValidEnvVarName(name string) bool {
+	return envVarName.MatchString(name)
+}
+
+// ReadEnvFile reads a .env file like the one used by heroku local
+func ReadEnvFile(path string) (map[string]string, error) {
+	file, err := os.Open(path)
+	if err != nil {
+		return nil, err
+	}
+	defer file.Close()
+
+	env, err := ParseEnvFile(file)
+	if err != nil {
+		return nil, fmt.Errorf("%s: %s", path, err)
+	}
+	return env, nil
+}
+
+// ParseEnvFile parses NAME=VALUE lines, with optional export prefixes,
+// # comments, and single or double quoted values. Double quoted values may
+// contain escapes and span several lines.
+func ParseEnvFile(r io.Reader) (map[string]string, error) {
+	env := map[string]string{}
+	scanner := bufio.NewScanner(r)
+	lineNum := 0
+	for scanner.Scan() {
+		lineNum++
+		line := strings.TrimSpace(scanner.Text())
+		if line == "" || strings.HasPrefix(line, "#") {
+			continue
+		}
+		startLine := lineNum
+
+		line = strings.TrimPrefix(line, "export ")
+		parts := strings.SplitN(line, "=", 2)
+		if len(parts) != 2 {
+			return nil, fmt.Errorf("line %d: expected NAME=VALUE", startLine)
+		}
+		name := strings.TrimSpace(parts[0])
+		if !ValidEnvVarName(name) {
+			return nil, fmt.Errorf("line %d: invalid name %q", startLine, name)
+		}
+		value := strings.TrimSpace(parts[1])
+
+		switch {
+		case strings.HasPrefix(value, `"`):
+			// keep reading lines until the closing quote
+			for {
+				unquoted, rest, ok := unquoteDouble(value)
+				if ok {
+					if !isComment(rest) {
+						return nil, fmt.Errorf("line %d: unexpected characters after quoted value", lineNum)
+					}
+					value = unquoted
+					break
+				}
+				if !scanner.Scan() {
+					return nil, fmt.Errorf("line %d: unterminated quoted value", startLine)
+				}
+				lineNum++
+				value += "\n" + scanner.Text()
+			}
+		case strings.HasPrefix(value, "'"):
+			end := strings.Index(value[1:], "'")
+			if end < 0 {
+				return nil, fmt.Errorf("line %d: unterminated quoted value", startLine)
+			}
+			if !isComment(value[end+2:]) {
+				return nil, fmt.Errorf("line %d: unexpected characters after quoted value", startLine)
+			}
+			value = value[1 : end+1]
+		default:
+			if i := strings.Index(value, " #"); i >= 0 {
+				value = strings.TrimSpace(value[:i])
+			}
+		}
+		env[name] = value
+	}
+	if err := scanner.Err(); err != nil {
+		return nil, err
+	}
+	return env, nil
+}
+
+// unquoteDouble unquotes a double quoted value, returning the text after the
+// closing quote. It returns false if the value has no closing quote yet.
+func unquoteDouble(value string) (string, string, bool) {
+	var out strings.Builder
+	for i := 1; i < len(value); i++ {
+		switch value[i] {
+		case '\\':
+			if i+1 == len(value) {
+				return "", "", false
+			}
+			i++
+			switch value[i] {
+			case 'n':
+				out.WriteByte('\n')
+			case 't':
+				out.WriteByte('\t')
+			case '"', '\\', '$':
+				out.WriteByte(value[i])
+			default:
+				out.WriteByte('\\')
+				out.WriteByte(value[i])
+			}
+		case '"':
+			return out.String(), value[i+1:], true
+		default:
+			out.WriteByte(value[i])
+		}
+	}
+	return "", "", false
+}
+
+func isComment(rest string) bool {
+	rest = strings.TrimSpace(rest)
+	return rest == "" || strings.HasPrefix(rest, "#")
+}
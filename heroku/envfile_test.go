@@ -0,0 +1,46 @@
+package heroku
+
+import (
+	"strings"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestParseEnvFile(t *testing.T) {
+	env, err := ParseEnvFile(strings.NewReader(`
+# a comment
+export RACK_ENV=production
+WEB_CONCURRENCY = 5 # inline comment
+EMPTY=
+SINGLE='single # quoted $HOME'
+DOUBLE="line one\nline \"two\""
+MULTI="first
+second" # trailing comment
+URL=postgres://localhost/db#fragment
+`))
+	assert.Nil(t, err)
+	assert.Equal(t, map[string]string{
+		"RACK_ENV":        "production",
+		"WEB_CONCURRENCY": "5",
+		"EMPTY":           "",
+		"SINGLE":          "single # quoted $HOME",
+		"DOUBLE":          "line one\nline \"two\"",
+		"MULTI":           "first\nsecond",
+		"URL":             "postgres://localhost/db#fragment",
+	}, env)
+}
+
+func TestParseEnvFileErrors(t *testing.T) {
+	_, err := ParseEnvFile(strings.NewReader("FOO=bar\nBAZ\n"))
+	assert.EqualError(t, err, "line 2: expected NAME=VALUE")
+
+	_, err = ParseEnvFile(strings.NewReader("1FOO=bar\n"))
+	assert.EqualError(t, err, `line 1: invalid name "1FOO"`)
+
+	_, err = ParseEnvFile(strings.NewReader("FOO=\"bar\nBAZ=qux\n"))
+	assert.EqualError(t, err, "line 1: unterminated quoted value")
+
+	_, err = ParseEnvFile(strings.NewReader("FOO='bar' baz\n"))
+	assert.EqualError(t, err, "line 1: unexpected characters after quoted value")
+}
@@ -0,0 +1,255 @@
+package heroku
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"reflect"
+	"regexp"
+	"strconv"
+	"strings"
+
+	"gopkg.in/yaml.v2"
+)
+
+// FileError is a problem in an app file like heroku.yml, with the line and
+// column it was found at when they are known
+type FileError struct {
+	File    string
+	Line    int
+	Column  int
+	Message string
+}
+
+func (e *FileError) Error() string {
+	switch {
+	case e.Line == 0:
+		return fmt.Sprintf("%s: %s", e.File, e.Message)
+	case e.Column == 0:
+		return fmt.Sprintf("%s:%d: %s", e.File, e.Line, e.Message)
+	default:
+		return fmt.Sprintf("%s:%d:%d: %s", e.File, e.Line, e.Column, e.Message)
+	}
+}
+
+// FileErrors holds every problem found in a file
+type FileErrors []*FileError
+
+func (e FileErrors) Error() string {
+	messages := make([]string, len(e))
+	for i, err := range e {
+		messages[i] = err.Error()
+	}
+	return strings.Join(messages, "\n")
+}
+
+var (
+	yamlErrorLine    = regexp.MustCompile(`^(?:yaml: )?line (\d+): (.*)$`)
+	yamlUnknownKey   = regexp.MustCompile(`^field (\S+) not found in type (\S+)$`)
+	yamlDuplicate    = regexp.MustCompile(`^key "(.*)" already set in map$`)
+	yamlTypeMismatch = regexp.MustCompile("^cannot unmarshal !!(\\w+)(?: `(.*)`)? into (\\S+)$")
+)
+
+// yamlTypes are the types that can be decoded from heroku.yml, by the name
+// yaml errors refer to them with
+var yamlTypes = map[string]reflect.Type{
+	"heroku.Config":        reflect.TypeOf(Config{}),
+	"heroku.SetupConfig":   reflect.TypeOf(SetupConfig{}),
+	"heroku.BuildConfig":   reflect.TypeOf(BuildConfig{}),
+	"heroku.addon":         reflect.TypeOf(Addon{}),
+	"heroku.dockerBuild":   reflect.TypeOf(DockerBuild{}),
+	"heroku.ReleaseConfig": reflect.TypeOf(ReleaseConfig{}),
+	"heroku.processConfig": reflect.TypeOf(ProcessConfig{}),
+}
+
+var yamlSections = map[string]string{
+	"heroku.SetupConfig":   "setup",
+	"heroku.BuildConfig":   "build",
+	"heroku.addon":         "add-on",
+	"heroku.dockerBuild":   "docker build",
+	"heroku.ReleaseConfig": "release",
+	"heroku.processConfig": "process type",
+}
+
+// yamlFileErrors converts a yaml error to errors with the line and column
+// of every problem, in terms of the keys of the file rather than Go types
+func yamlFileErrors(file string, source []byte, err error) FileErrors {
+	var messages []string
+	if typeErr, ok := err.(*yaml.TypeError); ok {
+		messages = typeErr.Errors
+	} else {
+		messages = []string{err.Error()}
+	}
+
+	lines := bytes.Split(source, []byte("\n"))
+	errs := make(FileErrors, len(messages))
+	for i, message := range messages {
+		fileErr := &FileError{File: file, Message: strings.TrimPrefix(message, "yaml: ")}
+		errs[i] = fileErr
+
+		matches := yamlErrorLine.FindStringSubmatch(message)
+		if matches == nil {
+			continue
+		}
+		fileErr.Line, _ = strconv.Atoi(matches[1])
+		fileErr.Message = matches[2]
+		line := ""
+		if fileErr.Line > 0 && fileErr.Line <= len(lines) {
+			line = string(lines[fileErr.Line-1])
+		}
+
+		if m := yamlUnknownKey.FindStringSubmatch(fileErr.Message); m != nil {
+			fileErr.Message = fmt.Sprintf("unknown key %q", m[1])
+			if section, ok := yamlSections[m[2]]; ok {
+				fileErr.Message += " in " + section
+			}
+			if keys := yamlKeys(yamlTypes[m[2]]); len(keys) > 0 {
+				fileErr.Message += fmt.Sprintf(", expected one of %s", strings.Join(keys, ", "))
+			}
+			fileErr.Column = column(line, m[1])
+		} else if m := yamlDuplicate.FindStringSubmatch(fileErr.Message); m != nil {
+			fileErr.Message = fmt.Sprintf("duplicate key %q", m[1])
+			fileErr.Column = column(line, m[1])
+		} else if m := yamlTypeMismatch.FindStringSubmatch(fileErr.Message); m != nil {
+			fileErr.Message = fmt.Sprintf("expected %s, got %s", describeType(m[3]), describeYAMLTag(m[1]))
+			if m[2] != "" {
+				// long values are shortened with ..., so the whole value is
+				// taken from the line
+				value := m[2]
+				fileErr.Column = column(line, strings.TrimSuffix(value, "..."))
+				if fileErr.Column > 0 {
+					value = strings.TrimSpace(line[fileErr.Column-1:])
+				}
+				fileErr.Message += fmt.Sprintf(" %q", value)
+			} else {
+				fileErr.Column = column(line, strings.TrimLeft(line, " \t-"))
+			}
+		}
+	}
+	return errs
+}
+
+// yamlKeys returns the keys yaml decodes into the fields of a struct
+func yamlKeys(t reflect.Type) []string {
+	if t == nil {
+		return nil
+	}
+	var keys []string
+	for i := 0; i < t.NumField(); i++ {
+		field := t.Field(i)
+		if field.PkgPath != "" {
+			continue
+		}
+		key := strings.Split(field.Tag.Get("yaml"), ",")[0]
+		if key == "-" {
+			continue
+		}
+		if key == "" {
+			key = strings.ToLower(field.Name)
+		}
+		keys = append(keys, key)
+	}
+	return keys
+}
+
+// jsonFileError converts a JSON decoding error to an error with the line
+// and column it occurred at
+func jsonFileError(file string, source []byte, err error) *FileError {
+	switch err := err.(type) {
+	case *json.SyntaxError:
+		// the offset is just past the invalid character
+		line, col := position(source, err.Offset-1)
+		return &FileError{File: file, Line: line, Column: col, Message: err.Error()}
+	case *json.UnmarshalTypeError:
+		line, col := position(source, jsonValueStart(source, err.Offset))
+		message := fmt.Sprintf("expected %s, got %s", describeType(err.Type.String()), err.Value)
+		if err.Field != "" {
+			message = fmt.Sprintf("%s: %s", err.Field, message)
+		}
+		return &FileError{File: file, Line: line, Column: col, Message: message}
+	default:
+		return &FileError{File: file, Message: err.Error()}
+	}
+}
+
+// jsonValueStart traces a string, number or literal back from the offset
+// just past it to its start. Objects and arrays are left at their end.
+func jsonValueStart(source []byte, offset int64) int64 {
+	if offset > int64(len(source)) {
+		offset = int64(len(source))
+	}
+	i := offset
+	if i > 0 && source[i-1] == '"' {
+		for i--; i > 0; i-- {
+			if source[i-1] == '"' && (i < 2 || source[i-2] != '\\') {
+				return i - 1
+			}
+		}
+		return offset
+	}
+	for i > 0 && strings.IndexByte(" \t\r\n:,[]{}", source[i-1]) < 0 {
+		i--
+	}
+	if i == offset {
+		return offset
+	}
+	return i
+}
+
+// position returns the line and column of a byte offset, counting from 1
+func position(source []byte, offset int64) (int, int) {
+	if offset > int64(len(source)) {
+		offset = int64(len(source))
+	} else if offset < 0 {
+		offset = 0
+	}
+	before := source[:offset]
+	line := bytes.Count(before, []byte("\n")) + 1
+	col := len(before) - bytes.LastIndexByte(before, '\n')
+	return line, col
+}
+
+// column returns the column of text in a line, counting from 1, or 0 if the
+// line doesn't contain it
+func column(line, text string) int {
+	if text == "" {
+		return 0
+	}
+	return strings.Index(line, text) + 1
+}
+
+func describeType(goType string) string {
+	switch {
+	case goType == "string":
+		return "a string"
+	case goType == "bool":
+		return "true or false"
+	case strings.HasPrefix(goType, "int"), strings.HasPrefix(goType, "float"):
+		return "a number"
+	case goType == "[]string":
+		return "a list of strings"
+	case strings.HasPrefix(goType, "[]"):
+		return "a list"
+	case strings.HasPrefix(goType, "map["), strings.HasPrefix(goType, "heroku."):
+		return "a map"
+	default:
+		return goType
+	}
+}
+
+func describeYAMLTag(tag string) string {
+	switch tag {
+	case "str":
+		return "a string"
+	case "seq":
+		return "a list"
+	case "map":
+		return "a map"
+	case "int", "float":
+		return "a number"
+	case "bool":
+		return "a boolean"
+	default:
+		return tag
+	}
+}
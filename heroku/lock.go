@@ -0,0 +1,100 @@
+package heroku
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+
+	"github.com/heroku/tatara/buildpack"
+)
+
+// LockfileName is the name of the lockfile in the app directory
+const LockfileName = "tatara.lock"
+
+// LockedStack pins the images of a stack to repo digests like
+// packs/heroku-16@sha256:<hex>. Images that only exist locally have no
+// digest and stay unpinned.
+type LockedStack struct {
+	Name             string `json:"name"`
+	BuildImage       string `json:"build_image"`
+	BuildImageDigest string `json:"build_image_digest,omitempty"`
+	RunImage         string `json:"run_image"`
+	RunImageDigest   string `json:"run_image_digest,omitempty"`
+}
+
+// BuildRef returns the pinned build image, or the build image if it isn't
+// pinned
+func (s *LockedStack) BuildRef() string {
+	if s.BuildImageDigest != "" {
+		return s.BuildImageDigest
+	}
+	return s.BuildImage
+}
+
+// RunRef returns the pinned run image, or the run image if it isn't pinned
+func (s *LockedStack) RunRef() string {
+	if s.RunImageDigest != "" {
+		return s.RunImageDigest
+	}
+	return s.RunImage
+}
+
+// Lockfile pins the stack images and buildpacks of an app, so that builds
+// only change when the lockfile is updated
+type Lockfile struct {
+	Stack *LockedStack `json:"stack,omitempty"`
+	buildpack.Lockfile
+}
+
+// LockfilePath returns the path of the lockfile for an app directory
+func LockfilePath(appDir string) string {
+	return filepath.Join(appDir, LockfileName)
+}
+
+// ReadLockfile reads the lockfile in appDir, returning an empty lockfile if
+// there isn't one
+func ReadLockfile(appDir string) (*Lockfile, error) {
+	lock := &Lockfile{}
+	lockBytes, err := ioutil.ReadFile(LockfilePath(appDir))
+	if os.IsNotExist(err) {
+		return lock, nil
+	} else if err != nil {
+		return nil, err
+	}
+	if err := json.Unmarshal(lockBytes, lock); err != nil {
+		return nil, fmt.Errorf("invalid lockfile %s: %s", LockfilePath(appDir), err)
+	}
+	return lock, nil
+}
+
+// Write writes the lockfile to appDir. An unchanged lockfile isn't
+// rewritten, so that it doesn't trigger file watchers.
+func (l *Lockfile) Write(appDir string) error {
+	l.Sort()
+	if l.Buildpacks == nil {
+		l.Buildpacks = []buildpack.LockedBuildpack{}
+	}
+	lockBytes, err := json.MarshalIndent(l, "", "  ")
+	if err != nil {
+		return err
+	}
+	lockBytes = append(lockBytes, '\n')
+
+	path := LockfilePath(appDir)
+	if existing, err := ioutil.ReadFile(path); err == nil && bytes.Equal(existing, lockBytes) {
+		return nil
+	}
+	return ioutil.WriteFile(path, lockBytes, 0644)
+}
+
+// PinnedStack returns the locked stack if it pins the images of the given
+// stack
+func (l *Lockfile) PinnedStack(stack Stack) (*LockedStack, bool) {
+	if l.Stack == nil || l.Stack.Name != stack.Name || l.Stack.BuildImage != stack.BuildImage || l.Stack.RunImage != stack.RunImage {
+		return nil, false
+	}
+	return l.Stack, true
+}
@@ -0,0 +1,42 @@
+package heroku
+
+import (
+	"io/ioutil"
+	"os"
+	"testing"
+
+	"github.com/heroku/tatara/buildpack"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestLockfile(t *testing.T) {
+	appDir, err := ioutil.TempDir("", "app")
+	assert.Nil(t, err)
+	defer os.RemoveAll(appDir)
+
+	lock, err := ReadLockfile(appDir)
+	assert.Nil(t, err)
+	assert.Nil(t, lock.Stack)
+
+	stack := Stack{Name: "heroku-16", BuildImage: "packs/heroku-16:build", RunImage: "packs/heroku-16:run"}
+	lock.Stack = &LockedStack{
+		Name:             stack.Name,
+		BuildImage:       stack.BuildImage,
+		BuildImageDigest: "packs/heroku-16@sha256:aaa",
+		RunImage:         stack.RunImage,
+	}
+	lock.Lock(buildpack.LockedBuildpack{URL: "https://example.com/ruby.tgz", SHA256: "abc"})
+	assert.Nil(t, lock.Write(appDir))
+
+	lock, err = ReadLockfile(appDir)
+	assert.Nil(t, err)
+	assert.Equal(t, []buildpack.LockedBuildpack{{URL: "https://example.com/ruby.tgz", SHA256: "abc"}}, lock.Buildpacks)
+
+	pinned, ok := lock.PinnedStack(stack)
+	assert.True(t, ok)
+	assert.Equal(t, "packs/heroku-16@sha256:aaa", pinned.BuildRef())
+	assert.Equal(t, "packs/heroku-16:run", pinned.RunRef())
+
+	_, ok = lock.PinnedStack(Stack{Name: "heroku-18", BuildImage: "packs/heroku-18:build", RunImage: "packs/heroku-18:run"})
+	assert.False(t, ok)
+}
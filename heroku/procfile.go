@@ -0,0 +1,137 @@
+package heroku
+
+import (
+	"archive/tar"
+	"bufio"
+	"compress/gzip"
+	"errors"
+	"fmt"
+	"io"
+	"os"
+	"path"
+	"regexp"
+	"strconv"
+	"strings"
+)
+
+var procfileLine = regexp.MustCompile(`^([A-Za-z0-9_-]+):\s*(.+)$`)
+
+// ErrNoProcfile is returned for a slug without a Procfile
+var ErrNoProcfile = errors.New("no Procfile found in slug")
+
+type Process struct {
+	Type    string
+	Command string
+}
+
+// Procfile holds the process types of an app in the order they are declared
+type Procfile []Process
+
+func ParseProcfile(r io.Reader) (Procfile, error) {
+	var procfile Procfile
+	scanner := bufio.NewScanner(r)
+	for lineNum := 1; scanner.Scan(); lineNum++ {
+		line := strings.TrimSpace(scanner.Text())
+		if line == "" || strings.HasPrefix(line, "#") {
+			continue
+		}
+		matches := procfileLine.FindStringSubmatch(line)
+		if matches == nil {
+			return nil, fmt.Errorf("invalid Procfile entry on line %d: %s", lineNum, line)
+		}
+		procfile = append(procfile, Process{Type: matches[1], Command: matches[2]})
+	}
+	return procfile, scanner.Err()
+}
+
+// ReadSlugProcfile reads the Procfile from a gzipped slug archive
+func ReadSlugProcfile(slugPath string) (Procfile, error) {
+	slugFile, err := os.Open(slugPath)
+	if err != nil {
+		return nil, err
+	}
+	defer slugFile.Close()
+
+	gzipReader, err := gzip.NewReader(slugFile)
+	if err != nil {
+		return nil, err
+	}
+	defer gzipReader.Close()
+
+	tarReader := tar.NewReader(gzipReader)
+	for {
+		header, err := tarReader.Next()
+		if err == io.EOF {
+			return nil, ErrNoProcfile
+		} else if err != nil {
+			return nil, err
+		}
+
+		switch path.Clean(strings.TrimPrefix(header.Name, "./")) {
+		case "Procfile", "app/Procfile":
+			return ParseProcfile(tarReader)
+		}
+	}
+}
+
+func (p Procfile) Command(processType string) (string, bool) {
+	for _, process := range p {
+		if process.Type == processType {
+			return process.Command, true
+		}
+	}
+	return "", false
+}
+
+func (p Procfile) ProcessTypes() []string {
+	processTypes := make([]string, len(p))
+	for i, process := range p {
+		processTypes[i] = process.Type
+	}
+	return processTypes
+}
+
+type FormationEntry struct {
+	Type     string
+	Quantity int
+}
+
+// Formation holds the number of dynos to run for each process type
+type Formation []FormationEntry
+
+// ParseFormation parses a formation like "web=1,worker=2"
+func ParseFormation(formation string) (Formation, error) {
+	var entries Formation
+	seen := map[string]bool{}
+	for _, entry := range strings.Split(formation, ",") {
+		parts := strings.SplitN(strings.TrimSpace(entry), "=", 2)
+		if parts[0] == "" {
+			return nil, fmt.Errorf("invalid formation entry: %q", entry)
+		}
+		if seen[parts[0]] {
+			return nil, fmt.Errorf("process type %s is in the formation more than once", parts[0])
+		}
+		seen[parts[0]] = true
+		quantity := 1
+		if len(parts) == 2 {
+			q, err := strconv.Atoi(parts[1])
+			if err != nil || q < 0 {
+				return nil, fmt.Errorf("invalid quantity for process type %s: %q", parts[0], parts[1])
+			}
+			quantity = q
+		}
+		entries = append(entries, FormationEntry{Type: parts[0], Quantity: quantity})
+	}
+	return entries, nil
+}
+
+// DefaultFormation runs one dyno of every process type except release
+func (p Procfile) DefaultFormation() Formation {
+	var entries Formation
+	for _, process := range p {
+		if process.Type != "release" {
+			entries = append(entries, FormationEntry{Type: process.Type, Quantity: 1})
+		}
+	}
+	return entries
+}
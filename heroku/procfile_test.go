@@ -0,0 +1,75 @@
+package heroku
+
+import (
+	"archive/tar"
+	"compress/gzip"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestParseProcfile(t *testing.T) {
+	procfile, err := ParseProcfile(strings.NewReader(`
+# comment
+web: bundle exec puma -p $PORT
+worker:bundle exec sidekiq
+`))
+	assert.Nil(t, err)
+	assert.Equal(t, Procfile{
+		{Type: "web", Command: "bundle exec puma -p $PORT"},
+		{Type: "worker", Command: "bundle exec sidekiq"},
+	}, procfile)
+	assert.Equal(t, []string{"web", "worker"}, procfile.ProcessTypes())
+}
+
+func TestParseProcfileInvalidLine(t *testing.T) {
+	_, err := ParseProcfile(strings.NewReader("web bundle exec puma\n"))
+	assert.EqualError(t, err, "invalid Procfile entry on line 1: web bundle exec puma")
+}
+
+func TestReadSlugProcfileWithoutProcfile(t *testing.T) {
+	dir, err := ioutil.TempDir("", "slug")
+	assert.Nil(t, err)
+	defer os.RemoveAll(dir)
+
+	slugPath := filepath.Join(dir, "app.slug")
+	file, err := os.Create(slugPath)
+	assert.Nil(t, err)
+	gzipWriter := gzip.NewWriter(file)
+	tarWriter := tar.NewWriter(gzipWriter)
+	assert.Nil(t, tarWriter.WriteHeader(&tar.Header{Typeflag: tar.TypeDir, Name: "./app/", Mode: 0755}))
+	assert.Nil(t, tarWriter.Close())
+	assert.Nil(t, gzipWriter.Close())
+	assert.Nil(t, file.Close())
+
+	_, err = ReadSlugProcfile(slugPath)
+	assert.Equal(t, ErrNoProcfile, err)
+
+	_, err = ReadSlugProcfile(filepath.Join(dir, "missing.slug"))
+	assert.True(t, os.IsNotExist(err))
+}
+
+func TestParseFormation(t *testing.T) {
+	formation, err := ParseFormation("web=1, worker=2,clock")
+	assert.Nil(t, err)
+	assert.Equal(t, Formation{
+		{Type: "web", Quantity: 1},
+		{Type: "worker", Quantity: 2},
+		{Type: "clock", Quantity: 1},
+	}, formation)
+
+	_, err = ParseFormation("web=two")
+	assert.EqualError(t, err, `invalid quantity for process type web: "two"`)
+
+	_, err = ParseFormation("web=1,worker,web=2")
+	assert.EqualError(t, err, "process type web is in the formation more than once")
+}
+
+func TestDefaultFormation(t *testing.T) {
+	procfile := Procfile{{Type: "release", Command: "rake db:migrate"}, {Type: "web", Command: "puma"}}
+	assert.Equal(t, Formation{{Type: "web", Quantity: 1}}, procfile.DefaultFormation())
+}
@@ -0,0 +1,124 @@
+package heroku
+
+import (
+	"archive/tar"
+	"compress/gzip"
+	"fmt"
+	"io"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"sort"
+	"strconv"
+	"time"
+)
+
+// SourceDateEpoch returns the time given by $SOURCE_DATE_EPOCH, or the Unix
+// epoch if it isn't set
+func SourceDateEpoch() (time.Time, error) {
+	epoch := os.Getenv("SOURCE_DATE_EPOCH")
+	if epoch == "" {
+		return time.Unix(0, 0).UTC(), nil
+	}
+	seconds, err := strconv.ParseInt(epoch, 10, 64)
+	if err != nil {
+		return time.Time{}, fmt.Errorf("invalid SOURCE_DATE_EPOCH %q", epoch)
+	}
+	return time.Unix(seconds, 0).UTC(), nil
+}
+
+// NormalizeHeader removes the times from a tar header, which differ between
+// builds. Owners and permission bits are kept, so that the app keeps
+// belonging to the user that built it and private files stay private.
+func NormalizeHeader(header *tar.Header, modTime time.Time) {
+	header.ModTime = modTime
+	header.AccessTime = time.Time{}
+	header.ChangeTime = time.Time{}
+	for _, key := range []string{"mtime", "atime", "ctime"} {
+		delete(header.PAXRecords, key)
+	}
+}
+
+// NormalizeSlug rewrites a gzipped slug with sorted entries and normalized
+// headers, so that slugs with the same contents are byte for byte identical
+func NormalizeSlug(slugPath string, modTime time.Time) error {
+	slugFile, err := os.Open(slugPath)
+	if err != nil {
+		return err
+	}
+	defer slugFile.Close()
+	gzipReader, err := gzip.NewReader(slugFile)
+	if err != nil {
+		return err
+	}
+
+	// entries are read into a seekable copy of the tar, so that they can be
+	// written out in order without holding the slug in memory
+	tmpTar, err := ioutil.TempFile(filepath.Dir(slugPath), ".slug-tar-")
+	if err != nil {
+		return err
+	}
+	defer os.Remove(tmpTar.Name())
+	defer tmpTar.Close()
+
+	type entry struct {
+		header *tar.Header
+		offset int64
+	}
+	var entries []entry
+	var offset int64
+	tarReader := tar.NewReader(gzipReader)
+	for {
+		header, err := tarReader.Next()
+		if err == io.EOF {
+			break
+		} else if err != nil {
+			return err
+		}
+		size, err := io.Copy(tmpTar, tarReader)
+		if err != nil {
+			return err
+		}
+		entries = append(entries, entry{header, offset})
+		offset += size
+	}
+
+	// hard links have to follow the files they link to
+	sort.SliceStable(entries, func(i, j int) bool {
+		iLink, jLink := entries[i].header.Typeflag == tar.TypeLink, entries[j].header.Typeflag == tar.TypeLink
+		if iLink != jLink {
+			return jLink
+		}
+		return entries[i].header.Name < entries[j].header.Name
+	})
+
+	outPath := slugPath + ".tmp"
+	outFile, err := os.Create(outPath)
+	if err != nil {
+		return err
+	}
+	defer os.Remove(outPath)
+	defer outFile.Close()
+
+	gzipWriter := gzip.NewWriter(outFile)
+	tarWriter := tar.NewWriter(gzipWriter)
+	for _, e := range entries {
+		NormalizeHeader(e.header, modTime)
+		if err := tarWriter.WriteHeader(e.header); err != nil {
+			return err
+		}
+		if _, err := io.Copy(tarWriter, io.NewSectionReader(tmpTar, e.offset, e.header.Size)); err != nil {
+			return err
+		}
+	}
+	if err := tarWriter.Close(); err != nil {
+		return err
+	}
+	if err := gzipWriter.Close(); err != nil {
+		return err
+	}
+	if err := outFile.Close(); err != nil {
+		return err
+	}
+	return os.Rename(outPath, slugPath)
+}
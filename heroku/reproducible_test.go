@@ -0,0 +1,91 @@
+package heroku
+
+import (
+	"archive/tar"
+	"compress/gzip"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func writeTestSlug(t *testing.T, path string, modTime time.Time, uid int, names []string) {
+	file, err := os.Create(path)
+	assert.Nil(t, err)
+	defer file.Close()
+	gzipWriter := gzip.NewWriter(file)
+	gzipWriter.ModTime = modTime
+	tarWriter := tar.NewWriter(gzipWriter)
+	for _, name := range names {
+		contents := []byte("contents of " + name)
+		err := tarWriter.WriteHeader(&tar.Header{
+			Typeflag: tar.TypeReg,
+			Name:     name,
+			Mode:     0664,
+			Size:     int64(len(contents)),
+			ModTime:  modTime,
+			Uid:      uid,
+		})
+		assert.Nil(t, err)
+		_, err = tarWriter.Write(contents)
+		assert.Nil(t, err)
+	}
+	assert.Nil(t, tarWriter.Close())
+	assert.Nil(t, gzipWriter.Close())
+}
+
+func TestNormalizeSlug(t *testing.T) {
+	dir, err := ioutil.TempDir("", "slug")
+	assert.Nil(t, err)
+	defer os.RemoveAll(dir)
+
+	first := filepath.Join(dir, "first.slug")
+	second := filepath.Join(dir, "second.slug")
+	writeTestSlug(t, first, time.Now(), 1000, []string{"./app/b", "./app/a", "./app/Procfile"})
+	writeTestSlug(t, second, time.Now().Add(time.Hour), 1000, []string{"./app/Procfile", "./app/a", "./app/b"})
+
+	epoch := time.Unix(1500000000, 0)
+	assert.Nil(t, NormalizeSlug(first, epoch))
+	assert.Nil(t, NormalizeSlug(second, epoch))
+
+	firstChecksum, _, err := SlugChecksum(first)
+	assert.Nil(t, err)
+	secondChecksum, _, err := SlugChecksum(second)
+	assert.Nil(t, err)
+	assert.Equal(t, firstChecksum, secondChecksum)
+
+	slugFile, err := os.Open(first)
+	assert.Nil(t, err)
+	defer slugFile.Close()
+	gzipReader, err := gzip.NewReader(slugFile)
+	assert.Nil(t, err)
+	tarReader := tar.NewReader(gzipReader)
+	names := []string{}
+	for {
+		header, err := tarReader.Next()
+		if err != nil {
+			break
+		}
+		names = append(names, header.Name)
+		assert.Equal(t, int64(0664), header.Mode)
+		assert.Equal(t, 1000, header.Uid)
+		assert.True(t, header.ModTime.Equal(epoch))
+	}
+	assert.Equal(t, []string{"./app/Procfile", "./app/a", "./app/b"}, names)
+}
+
+func TestSourceDateEpoch(t *testing.T) {
+	os.Setenv("SOURCE_DATE_EPOCH", "1500000000")
+	defer os.Unsetenv("SOURCE_DATE_EPOCH")
+
+	epoch, err := SourceDateEpoch()
+	assert.Nil(t, err)
+	assert.Equal(t, int64(1500000000), epoch.Unix())
+
+	os.Setenv("SOURCE_DATE_EPOCH", "yesterday")
+	_, err = SourceDateEpoch()
+	assert.EqualError(t, err, `invalid SOURCE_DATE_EPOCH "yesterday"`)
+}
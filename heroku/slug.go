@@ -0,0 +1,83 @@
+package heroku
+
+import (
+	"crypto/sha256"
+	"encoding/json"
+	"fmt"
+	"io"
+	"io/ioutil"
+	"os"
+	"time"
+)
+
+// SlugManifest describes how a slug was built. Its fields follow the slug
+// object of the Heroku Platform API where there is one.
+type SlugManifest struct {
+	AppDir       string            `json:"app_dir"`
+	Buildpacks   []string          `json:"buildpacks"`
+	Stack        SlugStack         `json:"stack"`
+	ConfigId     string            `json:"config_id,omitempty"`
+	ProcessTypes map[string]string `json:"process_types"`
+	Checksum     string            `json:"checksum"`
+	Size         int64             `json:"size"`
+	Commit       string            `json:"commit,omitempty"`
+	// AppChecksum is the checksum of the app archive of a reproducible
+	// build
+	AppChecksum   string    `json:"app_checksum,omitempty"`
+	BuildDuration float64   `json:"build_duration"`
+	CreatedAt     time.Time `json:"created_at"`
+}
+
+type SlugStack struct {
+	Name             string `json:"name"`
+	ID               string `json:"id,omitempty"`
+	BuildImage       string `json:"build_image"`
+	BuildImageDigest string `json:"build_image_digest,omitempty"`
+	RunImage         string `json:"run_image"`
+	RunImageDigest   string `json:"run_image_digest,omitempty"`
+	// RunImageLocal is set when the run image was built from heroku.yml
+	// and can't be pulled
+	RunImageLocal bool `json:"run_image_local,omitempty"`
+}
+
+// SlugManifestPath returns the path of the manifest written next to a slug
+func SlugManifestPath(slugPath string) string {
+	return slugPath + ".json"
+}
+
+func ReadSlugManifest(slugPath string) (SlugManifest, error) {
+	var manifest SlugManifest
+	manifestBytes, err := ioutil.ReadFile(SlugManifestPath(slugPath))
+	if err != nil {
+		return manifest, err
+	}
+	if err := json.Unmarshal(manifestBytes, &manifest); err != nil {
+		return manifest, fmt.Errorf("invalid slug manifest %s: %s", SlugManifestPath(slugPath), err)
+	}
+	return manifest, nil
+}
+
+func WriteSlugManifest(slugPath string, manifest SlugManifest) error {
+	manifestBytes, err := json.MarshalIndent(manifest, "", "  ")
+	if err != nil {
+		return err
+	}
+	return ioutil.WriteFile(SlugManifestPath(slugPath), append(manifestBytes, '\n'), 0644)
+}
+
+// SlugChecksum returns the checksum and size of a slug, with the checksum in
+// the SHA256:<hex> format of the Heroku Platform API
+func SlugChecksum(slugPath string) (string, int64, error) {
+	slugFile, err := os.Open(slugPath)
+	if err != nil {
+		return "", 0, err
+	}
+	defer slugFile.Close()
+
+	hasher := sha256.New()
+	size, err := io.Copy(hasher, slugFile)
+	if err != nil {
+		return "", 0, err
+	}
+	return fmt.Sprintf("SHA256:%x", hasher.Sum(nil)), size, nil
+}
@@ -0,0 +1,38 @@
+package heroku
+
+import (
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestSlugManifestRoundTrip(t *testing.T) {
+	tmpDir, err := ioutil.TempDir("", "tatara")
+	assert.Nil(t, err)
+	defer os.RemoveAll(tmpDir)
+
+	slugPath := filepath.Join(tmpDir, "app.slug")
+	assert.Nil(t, ioutil.WriteFile(slugPath, []byte("slug"), 0644))
+
+	checksum, size, err := SlugChecksum(slugPath)
+	assert.Nil(t, err)
+	assert.Equal(t, "SHA256:cd03861f0ff8922a279f1eab771f91f6336df9e7dd9412355ec6a1a79c244a5e", checksum)
+	assert.Equal(t, int64(4), size)
+
+	manifest := SlugManifest{
+		Buildpacks:   []string{"https://example.com/buildpack.tgz"},
+		Stack:        SlugStack{Name: "heroku-16", BuildImage: "packs/heroku-16:build", RunImage: "packs/heroku-16:run"},
+		ProcessTypes: map[string]string{"web": "puma"},
+		Checksum:     checksum,
+		Size:         size,
+	}
+	assert.Nil(t, WriteSlugManifest(slugPath, manifest))
+	assert.Equal(t, filepath.Join(tmpDir, "app.slug.json"), SlugManifestPath(slugPath))
+
+	read, err := ReadSlugManifest(slugPath)
+	assert.Nil(t, err)
+	assert.Equal(t, manifest, read)
+}
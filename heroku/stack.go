@@ -0,0 +1,107 @@
+package heroku
+
+import (
+	"fmt"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+
+	"gopkg.in/yaml.v2"
+)
+
+// Stack is a named pair of build and run images
+type Stack struct {
+	Name       string `yaml:"name"`
+	BuildImage string `yaml:"build_image"`
+	RunImage   string `yaml:"run_image"`
+	// ID is the Cloud Native Buildpacks stack id
+	ID string `yaml:"id"`
+}
+
+// Stacks is a catalog of stacks by name
+type Stacks map[string]Stack
+
+var builtinStacks = []Stack{
+	{Name: "heroku-16", BuildImage: "packs/heroku-16:build", RunImage: "packs/heroku-16:run", ID: "heroku-16"},
+	{Name: "heroku-18", BuildImage: "packs/heroku-18:build", RunImage: "packs/heroku-18:run", ID: "heroku-18"},
+	{Name: "heroku-20", BuildImage: "packs/heroku-20:build", RunImage: "packs/heroku-20:run", ID: "heroku-20"},
+}
+
+// DefaultStacksFile is $TATARA_STACKS_FILE, or ~/.tatara/stacks.yml
+func DefaultStacksFile() string {
+	if path := os.Getenv("TATARA_STACKS_FILE"); path != "" {
+		return path
+	}
+	home := os.Getenv("HOME")
+	if home == "" {
+		home = os.Getenv("USERPROFILE")
+	}
+	if home == "" {
+		return ""
+	}
+	return filepath.Join(home, ".tatara", "stacks.yml")
+}
+
+// LoadStacks returns the built in stacks, extended or overridden by the
+// stacks in a YAML file like:
+//
+//	stacks:
+//	- name: custom
+//	  build_image: example/custom:build
+//	  run_image: example/custom:run
+//	  id: io.example.custom
+//
+// A missing file is ignored.
+func LoadStacks(path string) (Stacks, error) {
+	stacks := Stacks{}
+	for _, stack := range builtinStacks {
+		stacks[stack.Name] = stack
+	}
+	if path == "" {
+		return stacks, nil
+	}
+
+	stacksBytes, err := ioutil.ReadFile(path)
+	if os.IsNotExist(err) {
+		return stacks, nil
+	} else if err != nil {
+		return nil, err
+	}
+
+	var stacksFile struct {
+		Stacks []Stack `yaml:"stacks"`
+	}
+	if err := yaml.Unmarshal(stacksBytes, &stacksFile); err != nil {
+		return nil, fmt.Errorf("invalid stacks file %s: %s", path, err)
+	}
+	for _, stack := range stacksFile.Stacks {
+		if stack.Name == "" || stack.BuildImage == "" || stack.RunImage == "" {
+			return nil, fmt.Errorf("invalid stacks file %s: every stack needs a name, build_image and run_image", path)
+		}
+		if stack.ID == "" {
+			stack.ID = stack.Name
+		}
+		stacks[stack.Name] = stack
+	}
+	return stacks, nil
+}
+
+func (s Stacks) Lookup(name string) (Stack, error) {
+	stack, ok := s[name]
+	if !ok {
+		return Stack{}, fmt.Errorf("unknown stack %s, known stacks: %s", name, strings.Join(s.Names(), ", "))
+	}
+	return stack, nil
+}
+
+// Names returns the names of the stacks in order
+func (s Stacks) Names() []string {
+	names := make([]string, 0, len(s))
+	for name := range s {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	return names
+}
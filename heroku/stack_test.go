@@ -0,0 +1,60 @@
+package heroku
+
+import (
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestLoadStacks(t *testing.T) {
+	dir, err := ioutil.TempDir("", "stacks")
+	assert.Nil(t, err)
+	defer os.RemoveAll(dir)
+
+	stacks, err := LoadStacks(filepath.Join(dir, "missing.yml"))
+	assert.Nil(t, err)
+	stack, err := stacks.Lookup("heroku-18")
+	assert.Nil(t, err)
+	assert.Equal(t, "packs/heroku-18:build", stack.BuildImage)
+	assert.Equal(t, "packs/heroku-18:run", stack.RunImage)
+
+	path := filepath.Join(dir, "stacks.yml")
+	err = ioutil.WriteFile(path, []byte(`
+stacks:
+- name: custom
+  build_image: example/custom:build
+  run_image: example/custom:run
+- name: heroku-16
+  build_image: mirror/heroku-16:build
+  run_image: mirror/heroku-16:run
+  id: heroku-16
+`), 0644)
+	assert.Nil(t, err)
+
+	stacks, err = LoadStacks(path)
+	assert.Nil(t, err)
+	assert.Equal(t, Stack{
+		Name:       "custom",
+		BuildImage: "example/custom:build",
+		RunImage:   "example/custom:run",
+		ID:         "custom",
+	}, stacks["custom"])
+	assert.Equal(t, "mirror/heroku-16:run", stacks["heroku-16"].RunImage)
+
+	_, err = stacks.Lookup("cedar-14")
+	assert.EqualError(t, err, "unknown stack cedar-14, known stacks: custom, heroku-16, heroku-18, heroku-20")
+}
+
+func TestLoadStacksInvalid(t *testing.T) {
+	dir, err := ioutil.TempDir("", "stacks")
+	assert.Nil(t, err)
+	defer os.RemoveAll(dir)
+
+	path := filepath.Join(dir, "stacks.yml")
+	assert.Nil(t, ioutil.WriteFile(path, []byte("stacks:\n- name: custom\n"), 0644))
+	_, err = LoadStacks(path)
+	assert.EqualError(t, err, "invalid stacks file "+path+": every stack needs a name, build_image and run_image")
+}
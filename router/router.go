@@ -0,0 +1,166 @@
+package router
+
+import (
+	"bytes"
+	"context"
+	"crypto/rand"
+	"fmt"
+	"io"
+	"io/ioutil"
+	"net"
+	"net/http"
+	"net/http/httputil"
+	"net/url"
+	"strconv"
+	"sync"
+	"time"
+)
+
+// Timeout is how long the router waits for a dyno to start responding
+// before failing the request with an H12 error
+const Timeout = 30 * time.Second
+
+type contextKey struct{}
+
+// Router emulates the Heroku router in front of a single web dyno
+type Router struct {
+	// Dyno is the name of the dyno in log lines, e.g. web.1
+	Dyno string
+	// Port is the port the router is reachable on, sent as X-Forwarded-Port
+	Port int
+	// Logs receives one heroku[router] line per request
+	Logs io.Writer
+
+	proxy   *httputil.ReverseProxy
+	logLock sync.Mutex
+}
+
+// routerError is an error the Heroku router reports instead of a response
+type routerError struct {
+	Code string
+	Desc string
+}
+
+func New(target *url.URL, dyno string, port int, logs io.Writer) *Router {
+	return NewWithTimeout(target, dyno, port, logs, Timeout)
+}
+
+func NewWithTimeout(target *url.URL, dyno string, port int, logs io.Writer, timeout time.Duration) *Router {
+	proxy := httputil.NewSingleHostReverseProxy(target)
+	proxy.Transport = &transport{
+		Transport: &http.Transport{
+			Proxy:                 http.ProxyFromEnvironment,
+			ResponseHeaderTimeout: timeout,
+		},
+	}
+	return &Router{
+		Dyno:  dyno,
+		Port:  port,
+		Logs:  logs,
+		proxy: proxy,
+	}
+}
+
+func (r *Router) ServeHTTP(w http.ResponseWriter, req *http.Request) {
+	start := time.Now()
+
+	requestID := req.Header.Get("X-Request-Id")
+	if len(requestID) < 20 || len(requestID) > 200 {
+		requestID = newRequestID()
+	}
+	req.Header.Set("X-Request-Id", requestID)
+	req.Header.Set("X-Request-Start", strconv.FormatInt(start.UnixNano()/int64(time.Millisecond), 10))
+	req.Header.Set("X-Forwarded-Proto", "http")
+	req.Header.Set("X-Forwarded-Port", strconv.Itoa(r.Port))
+
+	var routerErr *routerError
+	req = req.WithContext(context.WithValue(req.Context(), contextKey{}, &routerErr))
+
+	rw := &responseWriter{ResponseWriter: w, status: http.StatusOK}
+	r.proxy.ServeHTTP(rw, req)
+
+	fwd, _, err := net.SplitHostPort(req.RemoteAddr)
+	if err != nil {
+		fwd = req.RemoteAddr
+	}
+
+	at := "info"
+	if routerErr != nil {
+		at = fmt.Sprintf("error code=%s desc=%q", routerErr.Code, routerErr.Desc)
+	}
+	r.log("at=%s method=%s path=%q host=%s request_id=%s fwd=%q dyno=%s connect=0ms service=%dms status=%d bytes=%d protocol=http",
+		at, req.Method, req.URL.RequestURI(), req.Host, requestID, fwd, r.Dyno,
+		time.Since(start)/time.Millisecond, rw.status, rw.bytes)
+}
+
+func (r *Router) log(format string, a ...interface{}) {
+	r.logLock.Lock()
+	defer r.logLock.Unlock()
+	fmt.Fprintf(r.Logs, "heroku[router]: "+format+"\n", a...)
+}
+
+// transport turns dyno failures into the responses the Heroku router sends
+type transport struct {
+	*http.Transport
+}
+
+func (t *transport) RoundTrip(req *http.Request) (*http.Response, error) {
+	res, err := t.Transport.RoundTrip(req)
+	if err == nil {
+		return res, nil
+	}
+
+	routerErr := &routerError{Code: "H13", Desc: "Connection closed without response"}
+	if netErr, ok := err.(net.Error); ok && netErr.Timeout() {
+		routerErr = &routerError{Code: "H12", Desc: "Request timeout"}
+	} else if opErr, ok := err.(*net.OpError); ok && opErr.Op == "dial" {
+		routerErr = &routerError{Code: "H10", Desc: "App crashed"}
+	}
+	if ref, ok := req.Context().Value(contextKey{}).(**routerError); ok {
+		*ref = routerErr
+	}
+
+	body := fmt.Sprintf("Application error (%s %s)\n", routerErr.Code, routerErr.Desc)
+	return &http.Response{
+		StatusCode:    http.StatusServiceUnavailable,
+		Status:        fmt.Sprintf("%d %s", http.StatusServiceUnavailable, http.StatusText(http.StatusServiceUnavailable)),
+		Proto:         "HTTP/1.1",
+		ProtoMajor:    1,
+		ProtoMinor:    1,
+		Header:        http.Header{"Content-Type": {"text/plain"}},
+		Body:          ioutil.NopCloser(bytes.NewBufferString(body)),
+		ContentLength: int64(len(body)),
+		Request:       req,
+	}, nil
+}
+
+type responseWriter struct {
+	http.ResponseWriter
+	status int
+	bytes  int
+}
+
+func (w *responseWriter) WriteHeader(status int) {
+	w.status = status
+	w.ResponseWriter.WriteHeader(status)
+}
+
+func (w *responseWriter) Write(data []byte) (int, error) {
+	n, err := w.ResponseWriter.Write(data)
+	w.bytes += n
+	return n, err
+}
+
+func (w *responseWriter) Flush() {
+	if flusher, ok := w.ResponseWriter.(http.Flusher); ok {
+		flusher.Flush()
+	}
+}
+
+func newRequestID() string {
+	b := make([]byte, 16)
+	rand.Read(b)
+	b[6] = (b[6] & 0x0f) | 0x40
+	b[8] = (b[8] & 0x3f) | 0x80
+	return fmt.Sprintf("%x-%x-%x-%x-%x", b[0:4], b[4:6], b[6:8], b[8:10], b[10:])
+}
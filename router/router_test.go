@@ -0,0 +1,78 @@
+package router
+
+import (
+	"bytes"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestRouterAddsHeaders(t *testing.T) {
+	var headers http.Header
+	dyno := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		headers = r.Header
+		w.Write([]byte("hello"))
+	}))
+	defer dyno.Close()
+
+	target, _ := url.Parse(dyno.URL)
+	logs := &bytes.Buffer{}
+	r := New(target, "web.1", 5000, logs)
+
+	rec := httptest.NewRecorder()
+	r.ServeHTTP(rec, httptest.NewRequest("GET", "/path?q=1", nil))
+
+	assert.Equal(t, 200, rec.Code)
+	assert.Equal(t, "hello", rec.Body.String())
+	assert.Equal(t, "http", headers.Get("X-Forwarded-Proto"))
+	assert.Equal(t, "5000", headers.Get("X-Forwarded-Port"))
+	assert.Equal(t, "192.0.2.1", headers.Get("X-Forwarded-For"))
+	assert.Len(t, headers.Get("X-Request-Id"), 36)
+	assert.NotEmpty(t, headers.Get("X-Request-Start"))
+
+	assert.True(t, strings.HasPrefix(logs.String(), `heroku[router]: at=info method=GET path="/path?q=1" `))
+	assert.Contains(t, logs.String(), "dyno=web.1")
+	assert.Contains(t, logs.String(), "status=200 bytes=5 protocol=http")
+}
+
+func TestRouterKeepsValidRequestID(t *testing.T) {
+	var requestID string
+	dyno := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		requestID = r.Header.Get("X-Request-Id")
+	}))
+	defer dyno.Close()
+
+	target, _ := url.Parse(dyno.URL)
+	r := New(target, "web.1", 5000, &bytes.Buffer{})
+
+	req := httptest.NewRequest("GET", "/", nil)
+	req.Header.Set("X-Request-Id", "abcdefghijklmnopqrstuvwxyz")
+	r.ServeHTTP(httptest.NewRecorder(), req)
+
+	assert.Equal(t, "abcdefghijklmnopqrstuvwxyz", requestID)
+}
+
+func TestRouterRequestTimeout(t *testing.T) {
+	done := make(chan struct{})
+	dyno := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		<-done
+	}))
+	defer dyno.Close()
+	defer close(done)
+
+	target, _ := url.Parse(dyno.URL)
+	logs := &bytes.Buffer{}
+	r := NewWithTimeout(target, "web.1", 5000, logs, 50*time.Millisecond)
+
+	rec := httptest.NewRecorder()
+	r.ServeHTTP(rec, httptest.NewRequest("GET", "/slow", nil))
+
+	assert.Equal(t, 503, rec.Code)
+	assert.Contains(t, logs.String(), `at=error code=H12 desc="Request timeout" method=GET path="/slow"`)
+	assert.Contains(t, logs.String(), "status=503")
+}
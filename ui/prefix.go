@@ -0,0 +1,48 @@
+package ui
+
+import (
+	"bytes"
+	"io"
+	"sync"
+)
+
+// PrefixWriter writes complete lines to Out with Prefix prepended. Writers
+// that share a Lock never interleave partial lines.
+type PrefixWriter struct {
+	Out    io.Writer
+	Prefix string
+	Lock   *sync.Mutex
+
+	buf []byte
+}
+
+func (p *PrefixWriter) Write(data []byte) (int, error) {
+	p.buf = append(p.buf, data...)
+	for {
+		i := bytes.IndexByte(p.buf, '\n')
+		if i < 0 {
+			return len(data), nil
+		}
+		if err := p.writeLine(p.buf[:i+1]); err != nil {
+			return 0, err
+		}
+		p.buf = p.buf[i+1:]
+	}
+}
+
+// Flush writes any buffered partial line
+func (p *PrefixWriter) Flush() error {
+	if len(p.buf) == 0 {
+		return nil
+	}
+	err := p.writeLine(append(p.buf, '\n'))
+	p.buf = nil
+	return err
+}
+
+func (p *PrefixWriter) writeLine(line []byte) error {
+	p.Lock.Lock()
+	defer p.Lock.Unlock()
+	_, err := p.Out.Write(append([]byte(p.Prefix), line...))
+	return err
+}
@@ -0,0 +1,73 @@
+package util
+
+import (
+	"os"
+	"os/exec"
+	"path/filepath"
+	"strings"
+)
+
+// GitCommit returns the commit checked out in dir
+func GitCommit(dir string) (string, error) {
+	cmd := exec.Command("git", "-C", dir, "rev-parse", "HEAD")
+	stdout, err := cmd.Output()
+	if err != nil {
+		return "", err
+	}
+	return strings.TrimSpace(string(stdout)), nil
+}
+
+// GitTopLevel returns the root of the git work tree containing dir
+func GitTopLevel(dir string) (string, error) {
+	return gitOutput(dir, "rev-parse", "--show-toplevel")
+}
+
+// GitDir returns the absolute path of the git directory for dir
+func GitDir(dir string) (string, error) {
+	gitDir, err := gitOutput(dir, "rev-parse", "--git-dir")
+	if err != nil {
+		return "", err
+	}
+	if !filepath.IsAbs(gitDir) {
+		gitDir = filepath.Join(dir, gitDir)
+	}
+	return gitDir, nil
+}
+
+// GitExcludesFile returns the core.excludesFile setting, or git's default of
+// $XDG_CONFIG_HOME/git/ignore
+func GitExcludesFile(dir string) string {
+	if path, err := gitOutput(dir, "config", "--path", "core.excludesFile"); err == nil && path != "" {
+		return path
+	}
+	if xdg := os.Getenv("XDG_CONFIG_HOME"); xdg != "" {
+		return filepath.Join(xdg, "git", "ignore")
+	}
+	if home := os.Getenv("HOME"); home != "" {
+		return filepath.Join(home, ".config", "git", "ignore")
+	}
+	return ""
+}
+
+// GitTrackedFiles returns the files tracked by git under dir, relative to dir
+func GitTrackedFiles(dir string) ([]string, error) {
+	cmd := exec.Command("git", "-C", dir, "ls-files", "-z", "--cached")
+	stdout, err := cmd.Output()
+	if err != nil {
+		return nil, err
+	}
+	files := strings.Split(strings.TrimSuffix(string(stdout), "\x00"), "\x00")
+	if len(files) == 1 && files[0] == "" {
+		return nil, nil
+	}
+	return files, nil
+}
+
+func gitOutput(dir string, args ...string) (string, error) {
+	cmd := exec.Command("git", append([]string{"-C", dir}, args...)...)
+	stdout, err := cmd.Output()
+	if err != nil {
+		return "", err
+	}
+	return strings.TrimSpace(string(stdout)), nil
+}